@@ -0,0 +1,169 @@
+package analyze
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"http-perf-go/internal"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// qlog files or directories containing qlog files, searched recursively
+	Paths []string
+	// directory to write CSV files of the metrics and stream timelines to.
+	// if empty, no CSV files are written
+	CSVDir string
+	// print the RTT, congestion window and received bytes in this interval.
+	// 0 means only the summary is printed
+	Interval time.Duration
+}
+
+// Run analyzes every qlog file
+func Run(config Config) error {
+	files, err := findQlogFiles(config.Paths)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no qlog files found")
+	}
+	if config.CSVDir != "" {
+		err = os.MkdirAll(config.CSVDir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		t, err := readTrace(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		report(file, t, config.Interval)
+		if config.CSVDir != "" {
+			err = writeCSV(filepath.Join(config.CSVDir, qlogName(file)), t)
+			if err != nil {
+				return fmt.Errorf("failed to write csv files of %s: %w", file, err)
+			}
+		}
+	}
+	return nil
+}
+
+// findQlogFiles returns the files and the qlog files in the directories
+func findQlogFiles(paths []string) ([]string, error) {
+	files := make([]string, 0)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && qlogCompression(file) != "invalid" {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// qlogCompression returns the content encoding by the file extension, or "invalid" for other files
+func qlogCompression(file string) string {
+	switch {
+	case strings.HasSuffix(file, ".qlog"):
+		return ""
+	case strings.HasSuffix(file, ".qlog.gz"):
+		return internal.QLOG_COMPRESSION_GZIP
+	case strings.HasSuffix(file, ".qlog.zst"):
+		return internal.QLOG_COMPRESSION_ZSTD
+	default:
+		return "invalid"
+	}
+}
+
+// qlogName returns the file name without directory and extensions
+func qlogName(file string) string {
+	name := filepath.Base(file)
+	if i := strings.Index(name, ".qlog"); i > 0 {
+		return name[:i]
+	}
+	return name
+}
+
+func readTrace(file string) (*trace, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	compression := qlogCompression(file)
+	if compression == "invalid" {
+		compression = "" // explicitly passed files are read uncompressed
+	}
+	r, err := internal.NewContentDecoder(compression, f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return parseTrace(r)
+}
+
+// report logs the summary of the trace and the timeline in the interval
+func report(file string, t *trace, interval time.Duration) {
+	handshake := "not confirmed"
+	if d := t.handshakeDuration(); d >= 0 {
+		handshake = fmt.Sprintf("%f s", d)
+	}
+	log.Infof("%s: %s, odcid: %s, handshake: %s, duration: %f s", file, t.vantagePoint, t.odcid, handshake, t.lastEventAt-math.Max(t.startedAt, 0))
+	log.Infof("packets sent: %d (%d B), received: %d (%d B), lost: %d, retransmitted stream bytes: %d B", t.packetsSent, t.bytesSent, t.packetsReceived, t.bytesReceived, t.packetsLost, t.retransmittedBytes)
+	if len(t.metrics) > 0 {
+		var maxSmoothedRTT float64
+		var minCongestionWindow, maxCongestionWindow int64 = math.MaxInt64, 0
+		for _, m := range t.metrics {
+			maxSmoothedRTT = math.Max(maxSmoothedRTT, m.smoothedRTT)
+			if m.congestionWindow > 0 {
+				minCongestionWindow = internal.Min(minCongestionWindow, m.congestionWindow)
+			}
+			maxCongestionWindow = internal.Max(maxCongestionWindow, m.congestionWindow)
+		}
+		if maxCongestionWindow == 0 {
+			minCongestionWindow = 0
+		}
+		last := t.metrics[len(t.metrics)-1]
+		log.Infof("rtt min: %.3f ms, smoothed max: %.3f ms, final: %.3f ms, congestion window min: %d B, max: %d B, final: %d B, %d updates", last.minRTT, maxSmoothedRTT, last.smoothedRTT, minCongestionWindow, maxCongestionWindow, last.congestionWindow, len(t.metrics))
+	}
+	for _, s := range t.sortedStreams() {
+		log.Infof("stream %d: sent %d B, received %d B, %f s - %f s", s.id, s.bytesSent, s.bytesReceived, s.firstAt, s.lastAt)
+	}
+	if interval <= 0 {
+		return
+	}
+	step := interval.Seconds()
+	frame := 0
+	var sent, received int64
+	for at := math.Max(t.startedAt, 0) + step; at < t.lastEventAt+step; at += step {
+		for ; frame < len(t.streamFrames) && t.streamFrames[frame].time <= at; frame++ {
+			if t.streamFrames[frame].sent {
+				sent += t.streamFrames[frame].length
+			} else {
+				received += t.streamFrames[frame].length
+			}
+		}
+		m, _ := t.metricsAt(at)
+		log.Infof("t=%.3f s: smoothed rtt: %.3f ms, latest rtt: %.3f ms, congestion window: %d B, bytes in flight: %d B, stream bytes sent: %d B, received: %d B", at, m.smoothedRTT, m.latestRTT, m.congestionWindow, m.bytesInFlight, sent, received)
+	}
+}
@@ -0,0 +1,67 @@
+package analyze
+
+import (
+	"encoding/csv"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"strconv"
+)
+
+// writeCSV writes <prefix>_metrics.csv and <prefix>_streams.csv
+func writeCSV(prefix string, t *trace) error {
+	metrics := make([][]string, 0, len(t.metrics)+1)
+	metrics = append(metrics, []string{"time_s", "min_rtt_ms", "smoothed_rtt_ms", "latest_rtt_ms", "rtt_variance_ms", "congestion_window", "bytes_in_flight", "packets_in_flight"})
+	for _, m := range t.metrics {
+		metrics = append(metrics, []string{
+			formatFloat(m.time),
+			formatFloat(m.minRTT),
+			formatFloat(m.smoothedRTT),
+			formatFloat(m.latestRTT),
+			formatFloat(m.rttVariance),
+			strconv.FormatInt(m.congestionWindow, 10),
+			strconv.FormatInt(m.bytesInFlight, 10),
+			strconv.FormatInt(m.packetsInFlight, 10),
+		})
+	}
+	err := writeCSVFile(prefix+"_metrics.csv", metrics)
+	if err != nil {
+		return err
+	}
+
+	streams := make([][]string, 0, len(t.streamFrames)+1)
+	streams = append(streams, []string{"time_s", "stream_id", "direction", "offset", "length", "fin"})
+	for _, f := range t.streamFrames {
+		direction := "received"
+		if f.sent {
+			direction = "sent"
+		}
+		streams = append(streams, []string{
+			formatFloat(f.time),
+			strconv.FormatInt(f.streamID, 10),
+			direction,
+			strconv.FormatInt(f.offset, 10),
+			strconv.FormatInt(f.length, 10),
+			strconv.FormatBool(f.fin),
+		})
+	}
+	return writeCSVFile(prefix+"_streams.csv", streams)
+}
+
+func writeCSVFile(filename string, records [][]string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	err = w.WriteAll(records)
+	if err != nil {
+		return err
+	}
+	log.Infof("created csv file: %s", filename)
+	return f.Close()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
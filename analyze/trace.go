@@ -0,0 +1,298 @@
+package analyze
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"http-perf-go/internal"
+	"io"
+	"sort"
+)
+
+// maximum length of a qlog line
+const maxLineSize = 16 << 20
+
+// trace is the analysis of one qlog file
+type trace struct {
+	odcid        string
+	vantagePoint string
+	// seconds since the reference time of the trace; negative if the event is missing
+	startedAt            float64
+	handshakeConfirmedAt float64
+	closedAt             float64
+	lastEventAt          float64
+	packetsSent          int64
+	packetsReceived      int64
+	packetsLost          int64
+	bytesSent            int64
+	bytesReceived        int64
+	// stream bytes sent again below the highest sent offset of the stream
+	retransmittedBytes int64
+	metrics            []metricsSample
+	streamFrames       []streamFrame
+	streams            map[int64]*streamSummary
+}
+
+// metricsSample is the state after a metrics_updated event
+type metricsSample struct {
+	time float64
+	// milliseconds
+	minRTT           float64
+	smoothedRTT      float64
+	latestRTT        float64
+	rttVariance      float64
+	congestionWindow int64
+	bytesInFlight    int64
+	packetsInFlight  int64
+}
+
+type streamFrame struct {
+	time     float64
+	streamID int64
+	sent     bool
+	offset   int64
+	length   int64
+	fin      bool
+}
+
+type streamSummary struct {
+	id            int64
+	bytesSent     int64
+	bytesReceived int64
+	firstAt       float64
+	lastAt        float64
+	// highest sent offset, to detect retransmissions
+	sentEnd int64
+}
+
+type qlogHeader struct {
+	QlogFormat string `json:"qlog_format"`
+	Trace      struct {
+		VantagePoint struct {
+			Type string `json:"type"`
+		} `json:"vantage_point"`
+		CommonFields struct {
+			ODCID string `json:"ODCID"`
+		} `json:"common_fields"`
+	} `json:"trace"`
+}
+
+type qlogEvent struct {
+	// milliseconds since the reference time
+	Time float64         `json:"time"`
+	Name string          `json:"name"`
+	Data json.RawMessage `json:"data"`
+}
+
+type packetData struct {
+	Header struct {
+		PacketType string `json:"packet_type"`
+	} `json:"header"`
+	Raw struct {
+		Length int64 `json:"length"`
+	} `json:"raw"`
+	Frames []struct {
+		FrameType string `json:"frame_type"`
+		StreamID  int64  `json:"stream_id"`
+		Offset    int64  `json:"offset"`
+		Length    int64  `json:"length"`
+		Fin       bool   `json:"fin"`
+	} `json:"frames"`
+}
+
+// metricsData fields are only present if they changed
+type metricsData struct {
+	MinRTT           *float64 `json:"min_rtt"`
+	SmoothedRTT      *float64 `json:"smoothed_rtt"`
+	LatestRTT        *float64 `json:"latest_rtt"`
+	RTTVariance      *float64 `json:"rtt_variance"`
+	CongestionWindow *int64   `json:"congestion_window"`
+	BytesInFlight    *int64   `json:"bytes_in_flight"`
+	PacketsInFlight  *int64   `json:"packets_in_flight"`
+}
+
+type keyData struct {
+	KeyType string `json:"key_type"`
+}
+
+// parseTrace reads a qlog file in the NDJSON format written by quic-go
+func parseTrace(r io.Reader) (*trace, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxLineSize)
+	if !scanner.Scan() {
+		if scanner.Err() != nil {
+			return nil, scanner.Err()
+		}
+		return nil, fmt.Errorf("empty qlog file")
+	}
+	var header qlogHeader
+	err := json.Unmarshal(scanner.Bytes(), &header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse qlog header: %w", err)
+	}
+	if header.QlogFormat != "NDJSON" {
+		return nil, fmt.Errorf("unsupported qlog format %q", header.QlogFormat)
+	}
+	t := &trace{
+		odcid:                header.Trace.CommonFields.ODCID,
+		vantagePoint:         header.Trace.VantagePoint.Type,
+		startedAt:            -1,
+		handshakeConfirmedAt: -1,
+		closedAt:             -1,
+		streams:              make(map[int64]*streamSummary),
+	}
+	line := 1
+	for scanner.Scan() {
+		line++
+		var event qlogEvent
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse line %d: %w", line, err)
+		}
+		err = t.add(&event)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s event in line %d: %w", event.Name, line, err)
+		}
+	}
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+	return t, nil
+}
+
+// add updates the trace with the event
+func (t *trace) add(event *qlogEvent) error {
+	time := event.Time / 1000
+	t.lastEventAt = time
+	switch event.Name {
+	case "transport:connection_started":
+		t.startedAt = time
+	case "transport:connection_closed":
+		t.closedAt = time
+	case "security:key_discarded":
+		var data keyData
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return err
+		}
+		// handshake keys are discarded when the handshake is confirmed
+		if (data.KeyType == "client_handshake_secret" || data.KeyType == "server_handshake_secret") && t.handshakeConfirmedAt < 0 {
+			t.handshakeConfirmedAt = time
+		}
+	case "recovery:packet_lost":
+		t.packetsLost++
+	case "recovery:metrics_updated":
+		var data metricsData
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return err
+		}
+		t.addMetrics(time, &data)
+	case "transport:packet_sent", "transport:packet_received":
+		var data packetData
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return err
+		}
+		t.addPacket(time, event.Name == "transport:packet_sent", &data)
+	}
+	return nil
+}
+
+func (t *trace) addMetrics(time float64, data *metricsData) {
+	var sample metricsSample
+	if len(t.metrics) > 0 {
+		sample = t.metrics[len(t.metrics)-1]
+	}
+	if data.MinRTT == nil && data.SmoothedRTT == nil && data.LatestRTT == nil && data.RTTVariance == nil &&
+		data.CongestionWindow == nil && data.BytesInFlight == nil && data.PacketsInFlight == nil {
+		return // e.g. PTO count updates
+	}
+	sample.time = time
+	if data.MinRTT != nil {
+		sample.minRTT = *data.MinRTT
+	}
+	if data.SmoothedRTT != nil {
+		sample.smoothedRTT = *data.SmoothedRTT
+	}
+	if data.LatestRTT != nil {
+		sample.latestRTT = *data.LatestRTT
+	}
+	if data.RTTVariance != nil {
+		sample.rttVariance = *data.RTTVariance
+	}
+	if data.CongestionWindow != nil {
+		sample.congestionWindow = *data.CongestionWindow
+	}
+	if data.BytesInFlight != nil {
+		sample.bytesInFlight = *data.BytesInFlight
+	}
+	if data.PacketsInFlight != nil {
+		sample.packetsInFlight = *data.PacketsInFlight
+	}
+	t.metrics = append(t.metrics, sample)
+}
+
+func (t *trace) addPacket(time float64, sent bool, data *packetData) {
+	if sent {
+		t.packetsSent++
+		t.bytesSent += data.Raw.Length
+	} else {
+		t.packetsReceived++
+		t.bytesReceived += data.Raw.Length
+	}
+	for _, frame := range data.Frames {
+		if frame.FrameType != "stream" {
+			continue
+		}
+		t.streamFrames = append(t.streamFrames, streamFrame{
+			time:     time,
+			streamID: frame.StreamID,
+			sent:     sent,
+			offset:   frame.Offset,
+			length:   frame.Length,
+			fin:      frame.Fin,
+		})
+		s, ok := t.streams[frame.StreamID]
+		if !ok {
+			s = &streamSummary{id: frame.StreamID, firstAt: time}
+			t.streams[frame.StreamID] = s
+		}
+		s.lastAt = time
+		if !sent {
+			s.bytesReceived += frame.Length
+			continue
+		}
+		s.bytesSent += frame.Length
+		if frame.Offset < s.sentEnd {
+			t.retransmittedBytes += internal.Min(frame.Length, s.sentEnd-frame.Offset)
+		}
+		if end := frame.Offset + frame.Length; end > s.sentEnd {
+			s.sentEnd = end
+		}
+	}
+}
+
+// sortedStreams returns the streams by ID
+func (t *trace) sortedStreams() []*streamSummary {
+	streams := make([]*streamSummary, 0, len(t.streams))
+	for _, s := range t.streams {
+		streams = append(streams, s)
+	}
+	sort.Slice(streams, func(i, j int) bool { return streams[i].id < streams[j].id })
+	return streams
+}
+
+// handshakeDuration returns a negative value if the handshake was not confirmed
+func (t *trace) handshakeDuration() float64 {
+	if t.startedAt < 0 || t.handshakeConfirmedAt < 0 {
+		return -1
+	}
+	return t.handshakeConfirmedAt - t.startedAt
+}
+
+// metricsAt returns the last metrics sample before or at time
+func (t *trace) metricsAt(time float64) (metricsSample, bool) {
+	i := sort.Search(len(t.metrics), func(i int) bool { return t.metrics[i].time > time })
+	if i == 0 {
+		return metricsSample{}, false
+	}
+	return t.metrics[i-1], true
+}
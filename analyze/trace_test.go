@@ -0,0 +1,42 @@
+package analyze
+
+import (
+	"strings"
+	"testing"
+)
+
+const testQlog = `{"qlog_format":"NDJSON","qlog_version":"draft-02","trace":{"vantage_point":{"type":"server"},"common_fields":{"ODCID":"abcd"}}}
+{"time":1,"name":"transport:connection_started","data":{}}
+{"time":2,"name":"recovery:metrics_updated","data":{"min_rtt":10,"smoothed_rtt":10,"latest_rtt":10,"congestion_window":1000}}
+{"time":3,"name":"transport:packet_sent","data":{"header":{"packet_type":"1RTT"},"raw":{"length":1200},"frames":[{"frame_type":"stream","stream_id":0,"offset":0,"length":1000}]}}
+{"time":4,"name":"security:key_discarded","data":{"trigger":"tls","key_type":"server_handshake_secret"}}
+{"time":5,"name":"recovery:metrics_updated","data":{"congestion_window":2000}}
+{"time":6,"name":"recovery:packet_lost","data":{"header":{"packet_type":"1RTT","packet_number":3},"trigger":"time_threshold"}}
+{"time":7,"name":"transport:packet_sent","data":{"header":{"packet_type":"1RTT"},"raw":{"length":800},"frames":[{"frame_type":"stream","stream_id":0,"offset":500,"length":600,"fin":true}]}}
+`
+
+func TestParseTrace(t *testing.T) {
+	trace, err := parseTrace(strings.NewReader(testQlog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trace.vantagePoint != "server" || trace.odcid != "abcd" {
+		t.Errorf("unexpected header %s %s", trace.vantagePoint, trace.odcid)
+	}
+	if d := trace.handshakeDuration(); d != 0.003 {
+		t.Errorf("expected handshake duration 0.003, got %f", d)
+	}
+	if trace.packetsSent != 2 || trace.bytesSent != 2000 || trace.packetsLost != 1 {
+		t.Errorf("unexpected packet counts %d %d %d", trace.packetsSent, trace.bytesSent, trace.packetsLost)
+	}
+	if trace.retransmittedBytes != 500 {
+		t.Errorf("expected 500 retransmitted bytes, got %d", trace.retransmittedBytes)
+	}
+	m, ok := trace.metricsAt(0.0055)
+	if !ok || m.congestionWindow != 2000 || m.smoothedRTT != 10 {
+		t.Errorf("unexpected metrics %+v", m)
+	}
+	if s := trace.streams[0]; s.bytesSent != 1600 || s.lastAt != 0.007 {
+		t.Errorf("unexpected stream %+v", s)
+	}
+}
@@ -0,0 +1,143 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"http-perf-go/client"
+	"http-perf-go/internal"
+	"http-perf-go/server"
+	"net"
+	u "net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const certificateValidity = 24 * time.Hour
+
+type Config struct {
+	// total size of the generated files
+	Size int64
+	// number of page requisites the size is split over.
+	// 0 means a single file is downloaded
+	Objects int
+	// number of client runs against the same server
+	Runs int
+	// template of every client run; the urls, the certificate and page requisites are overwritten.
+	// if qlog files are written to a directory, the files of a run are written to <dir>/<run id>/r<run>
+	Client client.Config
+	// template of the server; the address, the directory and the certificate are overwritten
+	Server server.Config
+}
+
+// Run starts a server on an ephemeral port of the loopback interface,
+// with a generated certificate and generated files in a temporary directory,
+// runs the client against it and returns the summaries of the client runs.
+// Everything is removed after the last run
+func Run(config Config) ([]*client.Summary, error) {
+	if config.Runs <= 0 {
+		return nil, fmt.Errorf("runs must be positive")
+	}
+	dir, err := os.MkdirTemp("", "http-perf-go-bench-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	cert, err := internal.GenerateCertificate(internal.CertificateConfig{
+		CommonName: "localhost",
+		Hostnames:  []string{"localhost"},
+		IPs:        []net.IP{net.IPv4(127, 0, 0, 1)},
+		Validity:   certificateValidity,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate: %w", err)
+	}
+	err = cert.WriteFiles(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	serveDir := filepath.Join(dir, "www")
+	path, err := writeFixtures(serveDir, config.Size, config.Objects)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate files: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	serverConfig := config.Server
+	serverConfig.Addr = "127.0.0.1:0"
+	serverConfig.ServeDir = serveDir
+	serverConfig.TlsCertFile = certFile
+	serverConfig.TlsKeyFile = keyFile
+	listening := make(chan *net.UDPAddr, 1)
+	serverConfig.OnListen = func(addr *net.UDPAddr) {
+		listening <- addr
+	}
+	sErr := make(chan error, 1)
+	go func() {
+		sErr <- server.RunContext(ctx, serverConfig)
+	}()
+	var addr *net.UDPAddr
+	select {
+	case addr = <-listening:
+	case err := <-sErr:
+		return nil, fmt.Errorf("failed to start server: %w", err)
+	}
+
+	url := &u.URL{Scheme: "https", Host: addr.String(), Path: path}
+	summaries := make([]*client.Summary, 0, config.Runs)
+	for run := 1; run <= config.Runs; run++ {
+		clientConfig := config.Client
+		clientConfig.Urls = []*u.URL{url}
+		clientConfig.TLSCertFile = certFile
+		clientConfig.PageRequisites = config.Objects > 0
+		if clientConfig.QlogConfig.Dir != "" {
+			clientConfig.QlogConfig.Dir = filepath.Join(clientConfig.QlogConfig.Dir, clientConfig.QlogConfig.RunID)
+			clientConfig.QlogConfig.RunID = fmt.Sprintf("r%d", run)
+		}
+		summary, err := client.RunWithSummary(clientConfig)
+		if err != nil {
+			// the server must not serve from the directory while it is removed
+			cancel()
+			<-sErr
+			return summaries, fmt.Errorf("run %d failed: %w", run, err)
+		}
+		summaries = append(summaries, summary)
+	}
+
+	cancel()
+	err = <-sErr
+	if err != nil {
+		return summaries, fmt.Errorf("server failed: %w", err)
+	}
+	report(summaries)
+	return summaries, nil
+}
+
+// report logs the goodput of every run and the mean
+func report(summaries []*client.Summary) {
+	var totalDuration time.Duration
+	var totalBytes int64
+	for i, s := range summaries {
+		totalDuration += s.Duration
+		totalBytes += s.ReceivedBytes
+		log.WithFields(log.Fields{
+			"run":                i + 1,
+			"duration":           s.Duration.Seconds(),
+			"received_bytes":     s.ReceivedBytes,
+			"congestion_control": s.CongestionControl,
+		}).Infof("run %d: %d B in %.3f s, %.2f Mbit/s, %d requests, congestion control: %s", i+1, s.ReceivedBytes, s.Duration.Seconds(), mbitPerSecond(s.ReceivedBytes, s.Duration), s.Requests, s.CongestionControl)
+	}
+	n := time.Duration(len(summaries))
+	log.Infof("mean of %d runs: %.3f s, %.2f Mbit/s", len(summaries), (totalDuration / n).Seconds(), mbitPerSecond(totalBytes, totalDuration))
+}
+
+func mbitPerSecond(bytes int64, duration time.Duration) float64 {
+	if duration <= 0 {
+		return 0
+	}
+	return float64(bytes) * 8 / 1e6 / duration.Seconds()
+}
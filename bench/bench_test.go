@@ -0,0 +1,68 @@
+package bench
+
+import (
+	"fmt"
+	"http-perf-go/client"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFixtures(t *testing.T) {
+	dir := t.TempDir()
+	path, err := writeFixtures(dir, 1000, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if path != "/index.html" {
+		t.Errorf("expected /index.html, got %s", path)
+	}
+	var total int64
+	for i, expected := range []int64{334, 333, 333} {
+		info, err := os.Stat(filepath.Join(dir, fmt.Sprintf("object-%d.bin", i)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if info.Size() != expected {
+			t.Errorf("expected object %d of %d B, got %d B", i, expected, info.Size())
+		}
+		total += info.Size()
+	}
+	if total != 1000 {
+		t.Errorf("expected 1000 B in total, got %d B", total)
+	}
+
+	path, err = writeFixtures(dir, 100_000, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(dir, path))
+	if err != nil || info.Size() != 100_000 {
+		t.Errorf("expected a single file of 100000 B")
+	}
+}
+
+func TestRun(t *testing.T) {
+	summaries, err := Run(Config{
+		Size:    100_000,
+		Objects: 4,
+		Runs:    2,
+		Client: client.Config{
+			ParallelRequests:   4,
+			MaxDepth:           -1,
+			SegmentConnections: 1,
+			ConnectionsPerHost: 1,
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("expected 2 summaries, got %d", len(summaries))
+	}
+	for _, s := range summaries {
+		if s.Requests != 5 || s.Failures != 0 || s.DecodedBytes < 100_000 {
+			t.Errorf("unexpected summary: %+v", s)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package bench
+
+import (
+	"fmt"
+	"http-perf-go/internal"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// writeFixtures writes random, incompressible files of the total size to dir.
+// Without objects, a single file is written.
+// Otherwise an HTML page referencing the objects as images is written, and the size is split evenly over the objects.
+// Returns the path of the file to request
+func writeFixtures(dir string, size int64, objects int) (string, error) {
+	if size < 0 || objects < 0 {
+		return "", fmt.Errorf("size and objects must not be negative")
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+	// the same content in every benchmark
+	random := rand.New(rand.NewSource(1))
+	if objects == 0 {
+		return "/file.bin", writeRandomFile(filepath.Join(dir, "file.bin"), size, random)
+	}
+	var page strings.Builder
+	page.WriteString("<!DOCTYPE html>\n<html><body>\n")
+	for i := 0; i < objects; i++ {
+		objectSize := size / int64(objects)
+		if int64(i) < size%int64(objects) {
+			objectSize++
+		}
+		name := fmt.Sprintf("object-%d.bin", i)
+		err = writeRandomFile(filepath.Join(dir, name), objectSize, random)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&page, "<img src=\"%s\">\n", name)
+	}
+	page.WriteString("</body></html>\n")
+	return "/index.html", os.WriteFile(filepath.Join(dir, "index.html"), []byte(page.String()), 0644)
+}
+
+func writeRandomFile(filename string, size int64, random *rand.Rand) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	buf := make([]byte, 64*1024)
+	for remaining := size; remaining > 0; {
+		n := int(internal.Min(remaining, int64(len(buf))))
+		random.Read(buf[:n])
+		_, err = f.Write(buf[:n])
+		if err != nil {
+			return err
+		}
+		remaining -= int64(n)
+	}
+	return f.Close()
+}
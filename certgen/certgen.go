@@ -0,0 +1,113 @@
+package certgen
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"http-perf-go/internal"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// the CA is created if the files do not exist yet
+	CACertFile string
+	CAKeyFile  string
+	// the leaf certificate signed by the CA
+	CertFile string
+	KeyFile  string
+	// subject alternative names of the leaf certificate
+	Hostnames []string
+	IPs       []net.IP
+	// if not empty, the names of the subdirectories are added to the hostnames,
+	// like the directory of a server in multi-domain mode
+	MultiDomainDir string
+	Validity       time.Duration
+}
+
+// Run creates or loads the CA and creates a leaf certificate signed by it.
+// Clients trust the leaf certificate with the CA certificate, e.g. with --tls-cert ca.crt
+func Run(config Config) error {
+	hostnames := config.Hostnames
+	if config.MultiDomainDir != "" {
+		domains, err := internal.ListHostnameDirectories(config.MultiDomainDir)
+		if err != nil {
+			return err
+		}
+		hostnames = append(hostnames, domains...)
+	}
+	if len(hostnames) == 0 && len(config.IPs) == 0 {
+		return fmt.Errorf("no hostnames or IPs specified")
+	}
+
+	ca, err := loadOrCreateCA(&config)
+	if err != nil {
+		return err
+	}
+	commonName := "http-perf-go server"
+	if len(hostnames) > 0 {
+		commonName = hostnames[0]
+	}
+	leaf, err := internal.GenerateCertificate(internal.CertificateConfig{
+		CommonName: commonName,
+		Hostnames:  hostnames,
+		IPs:        config.IPs,
+		Validity:   config.Validity,
+	}, ca)
+	if err != nil {
+		return fmt.Errorf("failed to generate certificate: %w", err)
+	}
+	err = leaf.WriteFiles(config.CertFile, config.KeyFile)
+	if err != nil {
+		return err
+	}
+	log.Infof("created certificate %s and key %s for %s", config.CertFile, config.KeyFile, subjectAltNames(hostnames, config.IPs))
+	return nil
+}
+
+func loadOrCreateCA(config *Config) (*internal.Certificate, error) {
+	_, err := os.Stat(config.CACertFile)
+	if err == nil {
+		ca, err := internal.LoadCertificate(config.CACertFile, config.CAKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load CA: %w", err)
+		}
+		if !ca.Cert.IsCA {
+			return nil, fmt.Errorf("%s is not a CA certificate", config.CACertFile)
+		}
+		log.Infof("using CA %s", config.CACertFile)
+		if ca.Cert.NotAfter.Before(time.Now().Add(config.Validity)) {
+			log.Warnf("CA expires at %s, the certificate is only valid until then", ca.Cert.NotAfter.Format(time.RFC3339))
+		}
+		return ca, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	ca, err := internal.GenerateCertificate(internal.CertificateConfig{
+		CommonName: "http-perf-go CA",
+		Validity:   config.Validity,
+		IsCA:       true,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate CA: %w", err)
+	}
+	err = ca.WriteFiles(config.CACertFile, config.CAKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("created CA certificate %s and key %s", config.CACertFile, config.CAKeyFile)
+	return ca, nil
+}
+
+func subjectAltNames(hostnames []string, ips []net.IP) string {
+	names := make([]string, 0, len(hostnames)+len(ips))
+	names = append(names, hostnames...)
+	for _, ip := range ips {
+		names = append(names, ip.String())
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,100 @@
+package certgen
+
+import (
+	"bytes"
+	"crypto/x509"
+	"http-perf-go/internal"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testConfig(dir string, validity time.Duration) Config {
+	return Config{
+		CACertFile: filepath.Join(dir, "ca.crt"),
+		CAKeyFile:  filepath.Join(dir, "ca.key"),
+		CertFile:   filepath.Join(dir, "server.crt"),
+		KeyFile:    filepath.Join(dir, "server.key"),
+		Hostnames:  []string{"localhost"},
+		IPs:        []net.IP{net.IPv4(127, 0, 0, 1)},
+		Validity:   validity,
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "www", "example.com"), 0755)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config := testConfig(dir, time.Hour)
+	config.MultiDomainDir = filepath.Join(dir, "www")
+	err = Run(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ca, err := internal.LoadCertificate(config.CACertFile, config.CAKeyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	leaf, err := internal.LoadCertificate(config.CertFile, config.KeyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	for _, name := range []string{"localhost", "example.com", "127.0.0.1"} {
+		_, err = leaf.Cert.Verify(x509.VerifyOptions{DNSName: name, Roots: roots})
+		if err != nil {
+			t.Errorf("expected valid certificate for %s: %v", name, err)
+		}
+	}
+
+	// the CA is reused and limits the validity of the next certificate
+	config.Validity = 24 * time.Hour
+	err = Run(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reused, err := internal.LoadCertificate(config.CACertFile, config.CAKeyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(reused.Cert.Raw, ca.Cert.Raw) {
+		t.Errorf("expected existing CA to be reused")
+	}
+	leaf, err = internal.LoadCertificate(config.CertFile, config.KeyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if leaf.Cert.NotAfter.After(ca.Cert.NotAfter) {
+		t.Errorf("expected certificate to expire with the CA at %s, got %s", ca.Cert.NotAfter, leaf.Cert.NotAfter)
+	}
+	_, err = leaf.Cert.Verify(x509.VerifyOptions{DNSName: "localhost", Roots: roots})
+	if err != nil {
+		t.Errorf("expected valid certificate: %v", err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	dir := t.TempDir()
+	config := testConfig(dir, time.Hour)
+	config.Hostnames, config.IPs = nil, nil
+	if Run(config) == nil {
+		t.Errorf("expected error without hostnames and IPs")
+	}
+
+	// a leaf certificate must not be used as CA
+	config = testConfig(dir, time.Hour)
+	err := Run(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config.CACertFile, config.CAKeyFile = config.CertFile, config.KeyFile
+	config.CertFile, config.KeyFile = filepath.Join(dir, "other.crt"), filepath.Join(dir, "other.key")
+	if Run(config) == nil {
+		t.Errorf("expected error for a CA that is no CA")
+	}
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpCache is a private HTTP cache following https://www.rfc-editor.org/rfc/rfc9111
+// only successful GET responses are stored
+type httpCache struct {
+	mutex   sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	header       http.Header
+	contentType  string
+	etag         string
+	lastModified string
+	// the decoded body; only stored if required for requisite extraction
+	body     []byte
+	storedAt time.Time
+	// the response must be revalidated before every use
+	noCache  bool
+	lifetime time.Duration
+}
+
+func newHttpCache() *httpCache {
+	return &httpCache{
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+func (c *httpCache) get(key string) *cacheEntry {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.entries[key]
+}
+
+// store adds the response to the cache, if it is cacheable
+func (c *httpCache) store(key string, rsp *http.Response, contentType string, body []byte) {
+	if rsp.StatusCode != http.StatusOK {
+		return
+	}
+	directives := parseCacheControl(rsp.Header.Get("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return
+	}
+	if rsp.Header.Get("Vary") == "*" {
+		return
+	}
+	entry := &cacheEntry{
+		header:       rsp.Header.Clone(),
+		contentType:  contentType,
+		etag:         rsp.Header.Get("ETag"),
+		lastModified: rsp.Header.Get("Last-Modified"),
+		body:         body,
+	}
+	entry.update(rsp.Header)
+	c.mutex.Lock()
+	c.entries[key] = entry
+	c.mutex.Unlock()
+}
+
+// update refreshes the freshness information, e.g. after a 304 response
+func (e *cacheEntry) update(header http.Header) {
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	_, e.noCache = directives["no-cache"]
+	e.storedAt = time.Now()
+	e.lifetime = freshnessLifetime(header, directives)
+	if age, err := strconv.Atoi(header.Get("Age")); err == nil {
+		e.lifetime -= time.Duration(age) * time.Second
+	}
+	if etag := header.Get("ETag"); etag != "" {
+		e.etag = etag
+	}
+	if lastModified := header.Get("Last-Modified"); lastModified != "" {
+		e.lastModified = lastModified
+	}
+}
+
+func (e *cacheEntry) isFresh() bool {
+	return !e.noCache && time.Now().Sub(e.storedAt) < e.lifetime
+}
+
+// setValidators adds the headers for a conditional request
+func (e *cacheEntry) setValidators(header http.Header) {
+	if e.etag != "" {
+		header.Set("If-None-Match", e.etag)
+	}
+	if e.lastModified != "" {
+		header.Set("If-Modified-Since", e.lastModified)
+	}
+}
+
+// freshnessLifetime follows https://www.rfc-editor.org/rfc/rfc9111#section-4.2.1
+func freshnessLifetime(header http.Header, directives map[string]string) time.Duration {
+	if maxAge, ok := directives["max-age"]; ok {
+		seconds, err := strconv.Atoi(maxAge)
+		if err != nil {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		date = time.Now()
+	}
+	if expiresHeader := header.Get("Expires"); expiresHeader != "" {
+		expires, err := http.ParseTime(expiresHeader)
+		if err != nil {
+			return 0 // invalid dates represent a time in the past
+		}
+		return expires.Sub(date)
+	}
+	// heuristic freshness, see https://www.rfc-editor.org/rfc/rfc9111#section-4.2.2
+	if lastModified, err := http.ParseTime(header.Get("Last-Modified")); err == nil {
+		return date.Sub(lastModified) / 10
+	}
+	return 0
+}
+
+// parseCacheControl returns the lower case directives and their unquoted arguments
+func parseCacheControl(cacheControl string) map[string]string {
+	directives := make(map[string]string)
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if name == "" {
+			continue
+		}
+		directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+	}
+	return directives
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFreshnessLifetime(t *testing.T) {
+	now := time.Now().UTC()
+	cases := []struct {
+		header   http.Header
+		expected time.Duration
+	}{
+		{http.Header{"Cache-Control": {"public, max-age=60"}}, 60 * time.Second},
+		{http.Header{"Date": {now.Format(http.TimeFormat)}, "Expires": {now.Add(time.Hour).Format(http.TimeFormat)}}, time.Hour},
+		{http.Header{"Date": {now.Format(http.TimeFormat)}, "Expires": {"0"}}, 0},
+		{http.Header{"Date": {now.Format(http.TimeFormat)}, "Last-Modified": {now.Add(-100 * time.Hour).Format(http.TimeFormat)}}, 10 * time.Hour},
+		{http.Header{}, 0},
+	}
+	for _, c := range cases {
+		lifetime := freshnessLifetime(c.header, parseCacheControl(c.header.Get("Cache-Control")))
+		if lifetime != c.expected {
+			t.Errorf("expected %s for %v, got %s", c.expected, c.header, lifetime)
+		}
+	}
+}
+
+func TestCacheStore(t *testing.T) {
+	cache := newHttpCache()
+	cache.store("no-store", &http.Response{StatusCode: 200, Header: http.Header{"Cache-Control": {"no-store"}}}, "text/html", nil)
+	if cache.get("no-store") != nil {
+		t.Errorf("no-store responses must not be stored")
+	}
+	cache.store("no-cache", &http.Response{StatusCode: 200, Header: http.Header{"Cache-Control": {"no-cache, max-age=60"}, "Etag": {`"abc"`}}}, "text/html", nil)
+	entry := cache.get("no-cache")
+	if entry == nil || entry.isFresh() {
+		t.Errorf("no-cache responses must be stored but revalidated")
+	}
+	header := http.Header{}
+	entry.setValidators(header)
+	if header.Get("If-None-Match") != `"abc"` {
+		t.Errorf("conditional request must contain the ETag")
+	}
+	cache.store("fresh", &http.Response{StatusCode: 200, Header: http.Header{"Cache-Control": {"max-age=60"}}}, "text/html", nil)
+	if !cache.get("fresh").isFresh() {
+		t.Errorf("response must be fresh")
+	}
+}
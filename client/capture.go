@@ -0,0 +1,34 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/lucas-clemente/quic-go"
+	"net"
+)
+
+// dialWrapped dials like quic.DialAddrEarlyContext,
+// but on a UDP socket that is wrapped, e.g. to write every datagram to the packet capture.
+// The connection can not be migrated, because the socket is not a quic.MigratableUDPConn.
+func dialWrapped(ctx context.Context, addr string, tlsConf *tls.Config, config *quic.Config, wrap func(net.PacketConn) net.PacketConn) (quic.EarlyConnection, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+	if err != nil {
+		return nil, err
+	}
+	pconn := wrap(udpConn)
+	conn, err := quic.DialEarlyContext(ctx, pconn, udpAddr, addr, tlsConf, config)
+	if err != nil {
+		pconn.Close()
+		return nil, err
+	}
+	// quic-go only closes sockets it created itself
+	go func() {
+		<-conn.Context().Done()
+		pconn.Close()
+	}()
+	return conn, nil
+}
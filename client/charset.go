@@ -0,0 +1,76 @@
+package client
+
+import (
+	"bytes"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"http-perf-go/internal"
+	"mime"
+	"regexp"
+)
+
+var utf8Bom = []byte{0xEF, 0xBB, 0xBF}
+
+// the @charset rule must be at the very beginning of a stylesheet
+var cssCharsetRegexp = regexp.MustCompile(`^@charset "([^"]+)";`)
+
+// decodeToUtf8 transcodes HTML and CSS documents to UTF-8.
+// The encoding is detected by BOM, the charset parameter of the Content-Type header,
+// <meta charset> for HTML and @charset for CSS.
+// Other content types are returned unchanged.
+func decodeToUtf8(body []byte, contentTypeHeader string, contentType string) ([]byte, error) {
+	var enc encoding.Encoding
+	var name string
+	switch contentType {
+	case internal.MIME_TYPE_TEXT_HTML:
+		enc, name, _ = charset.DetermineEncoding(body, contentTypeHeader)
+	case internal.MIME_TYPE_TEXT_CSS:
+		enc, name = determineCssEncoding(body, contentTypeHeader)
+	default:
+		return body, nil
+	}
+	if name == "utf-8" {
+		return bytes.TrimPrefix(body, utf8Bom), nil
+	}
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimPrefix(decoded, utf8Bom), nil
+}
+
+// determineCssEncoding follows https://www.w3.org/TR/css-syntax-3/#input-byte-stream
+func determineCssEncoding(body []byte, contentTypeHeader string) (encoding.Encoding, string) {
+	if enc, name := bomEncoding(body); enc != nil {
+		return enc, name
+	}
+	_, params, err := mime.ParseMediaType(contentTypeHeader)
+	if err == nil {
+		if enc, name := charset.Lookup(params["charset"]); enc != nil {
+			return enc, name
+		}
+	}
+	if match := cssCharsetRegexp.FindSubmatch(body); match != nil {
+		if enc, name := charset.Lookup(string(match[1])); enc != nil {
+			if name == "utf-16be" || name == "utf-16le" {
+				// @charset can not be read in UTF-16
+				return charset.Lookup("utf-8")
+			}
+			return enc, name
+		}
+	}
+	return charset.Lookup("utf-8")
+}
+
+func bomEncoding(body []byte) (encoding.Encoding, string) {
+	switch {
+	case bytes.HasPrefix(body, utf8Bom):
+		return charset.Lookup("utf-8")
+	case bytes.HasPrefix(body, []byte{0xFE, 0xFF}):
+		return charset.Lookup("utf-16be")
+	case bytes.HasPrefix(body, []byte{0xFF, 0xFE}):
+		return charset.Lookup("utf-16le")
+	default:
+		return nil, ""
+	}
+}
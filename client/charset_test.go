@@ -0,0 +1,55 @@
+package client
+
+import (
+	"golang.org/x/text/encoding/japanese"
+	"testing"
+)
+
+func TestDecodeLatin1Html(t *testing.T) {
+	html := []byte("<html><head><meta charset=\"iso-8859-1\"></head><body><img src=\"caf\xe9.png\"></body></html>")
+	decoded, err := decodeToUtf8(html, "text/html", "text/html")
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	urls, err := getHtmlRequisites(decoded)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	expectUrls(t, urls, "caf%C3%A9.png")
+}
+
+func TestDecodeShiftJisCssFromHeader(t *testing.T) {
+	css, err := japanese.ShiftJIS.NewEncoder().Bytes([]byte(`body { background: url("画像.png"); }`))
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	decoded, err := decodeToUtf8(css, "text/css; charset=Shift_JIS", "text/css")
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if string(decoded) != `body { background: url("画像.png"); }` {
+		t.Errorf("unexpected decoded css: %s", decoded)
+	}
+}
+
+func TestDecodeCssCharsetRule(t *testing.T) {
+	css := []byte("@charset \"iso-8859-1\";\nbody { background: url(\"\xe9.png\"); }")
+	decoded, err := decodeToUtf8(css, "text/css", "text/css")
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if string(decoded) != "@charset \"iso-8859-1\";\nbody { background: url(\"é.png\"); }" {
+		t.Errorf("unexpected decoded css: %s", decoded)
+	}
+}
+
+func TestDecodeStripsBom(t *testing.T) {
+	css := append([]byte{0xEF, 0xBB, 0xBF}, []byte(`a { }`)...)
+	decoded, err := decodeToUtf8(css, "text/css; charset=iso-8859-1", "text/css")
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	if string(decoded) != `a { }` {
+		t.Errorf("unexpected decoded css: %q", decoded)
+	}
+}
@@ -2,8 +2,10 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
-	r "github.com/birneee/webpage-requisites-go"
+	"crypto/x509"
+	"fmt"
 	"github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/http3"
 	"github.com/lucas-clemente/quic-go/logging"
@@ -15,6 +17,7 @@ import (
 	u "net/url"
 	"regexp"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -24,7 +27,7 @@ type Config struct {
 	Urls                  []*u.URL
 	TLSCertFile           string
 	Qlog                  bool
-	QlogPrefix            string
+	QlogConfig            internal.QlogConfig
 	PageRequisites        bool
 	ParallelRequests      int
 	ProxyConfig           *quic.ProxyConfig
@@ -32,49 +35,245 @@ type Config struct {
 	ExtraStreamEncryption bool
 	UserAgent             string
 	UrlBlacklist          []*regexp.Regexp
+	// if not empty, only urls matching at least one of the expressions are requested
+	UrlAllowlist []*regexp.Regexp
+	// maximum depth of page requisites; the initial urls have depth 0.
+	// negative values mean unlimited depth
+	MaxDepth int
+	// request page requisites and follow links on other hosts than the hosts of the initial urls, like wget -H.
+	// with Domains, only on hosts of these domains
+	SpanHosts bool
+	// domains and their subdomains to request page requisites from.
+	// without SpanHosts, in addition to the hosts of the initial urls
+	Domains []string
+	// maximum number of requests.
+	// 0 means unlimited
+	MaxRequests int
+	// value of the Accept-Encoding request header.
+	// responses are decoded by the client, to count received and decoded bytes.
+	// if empty, only the identity encoding is accepted
+	AcceptEncoding string
+	// load the pages a second time with the HTTP cache of the first view,
+	// like the repeat view of WebPageTest
+	RepeatView bool
+	// follow hyperlinks of HTML documents and load the linked pages one after another
+	Recursive bool
+	// maximum number of links followed from an initial url
+	MaxLinkDepth int
+	// maximum number of pages loaded in recursive mode
+	MaxPages int
+	// timeout of a single request including reading the response body.
+	// 0 means no timeout
+	RequestTimeout time.Duration
+	// timeout of the whole run.
+	// 0 means no timeout
+	RunTimeout time.Duration
+	// number of retries of a request after a transport error
+	Retries int
+	// wait time before the first retry, doubled for every further retry
+	RetryBackoff time.Duration
+	// download the initial urls in this number of parallel range requests.
+	// 0 or 1 means a single request
+	Segments int
+	// number of QUIC connections the segments are distributed over
+	SegmentConnections int
+	// number of QUIC connections per host, requests are distributed round-robin
+	ConnectionsPerHost int
+	// open a new QUIC connection for every request
+	NewConnectionPerRequest bool
+	// maximum number of concurrent requests per QUIC connection.
+	// 0 means unlimited; not supported with NewConnectionPerRequest
+	MaxStreams int
+	// migrate the open QUIC connections to new UDP sockets after this duration.
+	// the new sockets are always bound to 0.0.0.0 and an ephemeral port,
+	// because quic-go does not support choosing the local address.
+	// 0 means no migration
+	MigrateAfterDuration time.Duration
+	// migrate the open QUIC connections to new UDP sockets after this number of received bytes.
+	// 0 means no migration
+	MigrateAfterBytes int64
+	// zero values select the quic-go defaults
+	TransportParameters internal.TransportParameters
+	CongestionControl   internal.CongestionControl
+	// address of the HTTP endpoint serving OpenMetrics at /metrics.
+	// if empty, the metrics endpoint is disabled
+	MetricsAddr string
+	// TLS secrets are written to it in the NSS key log format, to decrypt packet captures.
+	// may be nil
+	KeyLogWriter io.Writer
+	// write all sent and received UDP datagrams to this pcapng file.
+	// if empty, no packets are captured
+	PcapFile string
 }
 
 type client struct {
 	config               *Config
 	httpClient           *http.Client
 	totalReceivedBytes   atomic.Int64
+	totalDecodedBytes    atomic.Int64
 	totalQuicConnections atomic.Uint32
 	totalGetRequests     atomic.Int64
-	totalHttpErrors      atomic.Int64
+	totalRetries         atomic.Int64
+	failures             failureCounters
+	startedRequests      atomic.Int64
+	initialHosts         map[string]bool
+	requisiteExtractors  requisiteExtractors
+	urlQueue             internal.DistinctChannel[queuedUrl]
+	pendingRequests      internal.CondHelper[int]
+	pageQueue            internal.DistinctChannel[*page]
+	pageQueueMutex       sync.Mutex
+	queuedPages          int
+	cache                *httpCache
+	totalCacheHits       atomic.Int64
+	totalNotModified     atomic.Int64
+	// clients with separate connections for segmented downloads, including httpClient
+	segmentClients     []*http.Client
+	connectionRequests connectionRequestCounters
+	// nil if no migration is configured
+	migrator *migrator
+	metrics  *clientMetrics
+}
+
+type queuedUrl struct {
+	url u.URL
+	// depth of page requisites; 0 for the document of the page
+	depth int
+	page  *page
+}
+
+// Summary of a run.
+// With RepeatView, the summary of the repeat view is returned.
+type Summary struct {
+	ReceivedBytes int64
+	DecodedBytes  int64
+	// from the first request until all requests are finished
+	Duration        time.Duration
+	Requests        int64
+	Retries         int64
+	Failures        int64
+	QuicConnections int64
+	CacheHits       int64
+	NotModified     int64
+	// e.g. "reno", see internal.CongestionControl.String
+	CongestionControl string
 }
 
 // Run blocks until everything is downloaded
 func Run(config Config) error {
+	_, err := RunWithSummary(config)
+	return err
+}
+
+// RunWithSummary blocks until everything is downloaded.
+// If the run times out, the summary is returned with the error
+func RunWithSummary(config Config) (*Summary, error) {
+	if config.Recursive && config.MaxPages <= 0 {
+		return nil, fmt.Errorf("recursive mode requires a positive page limit")
+	}
+	if config.NewConnectionPerRequest && config.MaxStreams > 0 {
+		return nil, fmt.Errorf("a stream limit is not supported with a new connection per request")
+	}
+	if config.CongestionControl.Paced() && (config.MigrateAfterDuration > 0 || config.MigrateAfterBytes > 0) {
+		return nil, fmt.Errorf("%s congestion control does not support connection migration", config.CongestionControl.Algorithm)
+	}
+
 	certPool, err := internal.SystemCertPoolWithAdditionalCert(config.TLSCertFile)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	log.Infof("quic transport parameters: %s", config.TransportParameters.Effective())
+
+	var registry internal.MetricsRegistry
+	if config.MetricsAddr != "" {
+		registry = internal.NewMetricsRegistry()
+		metricsServer, err := internal.StartMetricsServer(config.MetricsAddr, registry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start metrics endpoint: %w", err)
+		}
+		defer metricsServer.Close()
+	}
+	metrics := newClientMetrics(registry)
+
+	var pcap *internal.PcapWriter
+	if config.PcapFile != "" {
+		if config.MigrateAfterDuration > 0 || config.MigrateAfterBytes > 0 {
+			return nil, fmt.Errorf("packet capture does not support connection migration")
+		}
+		pcap, err = internal.CreatePcapFile(config.PcapFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create pcap file: %w", err)
+		}
+		defer pcap.Close()
+		log.Infof("created pcap file: %s", config.PcapFile)
 	}
 
+	ctx := context.Background()
+	if config.RunTimeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.RunTimeout)
+		defer cancel()
+	}
+
+	if !config.RepeatView {
+		return runView(ctx, &config, certPool, nil, metrics, pcap)
+	}
+	cache := newHttpCache()
+	log.Infof("first view")
+	summary, err := runView(ctx, &config, certPool, cache, metrics, pcap)
+	if err != nil {
+		return summary, err
+	}
+	log.Infof("repeat view")
+	return runView(ctx, &config, certPool, cache, metrics, pcap)
+}
+
+// runView loads the pages once.
+// The connections are closed afterwards, only the cache is kept.
+func runView(ctx context.Context, config *Config, certPool *x509.CertPool, cache *httpCache, metrics *clientMetrics, pcap *internal.PcapWriter) (*Summary, error) {
 	client := &client{
-		config: &config,
+		config:              config,
+		initialHosts:        make(map[string]bool),
+		requisiteExtractors: defaultRequisiteExtractors(),
+		cache:               cache,
+		metrics:             metrics,
+	}
+	for _, url := range config.Urls {
+		client.initialHosts[url.Hostname()] = true
+	}
+	if config.MigrateAfterDuration > 0 || config.MigrateAfterBytes > 0 {
+		client.migrator = newMigrator(config.MigrateAfterDuration, config.MigrateAfterBytes, metrics.connections)
 	}
 
 	tlsConf := &tls.Config{
-		RootCAs: certPool,
+		RootCAs:      certPool,
+		KeyLogWriter: config.KeyLogWriter,
 	}
 
 	tracers := make([]logging.Tracer, 0)
 
 	tracers = append(tracers, internal.NewEventTracer(internal.Handlers{
 		UpdatePath: func(odcid logging.ConnectionID, newRemote net.Addr) {
-			log.Infof("migrated QUIC connection %s to %s", odcid.String(), newRemote)
+			log.WithFields(log.Fields{"odcid": odcid.String(), "remote": newRemote.String()}).Infof("migrated QUIC connection %s to %s", odcid.String(), newRemote)
 		},
 		StartedConnection: func(odcid logging.ConnectionID, local, remote net.Addr, srcConnID, destConnID logging.ConnectionID) {
-			log.Infof("started QUIC connection %s", odcid.String())
+			log.WithFields(log.Fields{"odcid": odcid.String(), "congestion_control": config.CongestionControl.String()}).Infof("started QUIC connection %s, congestion control: %s", odcid.String(), config.CongestionControl)
 			client.totalQuicConnections.Add(1)
+			metrics.connections.StartedConnection(odcid)
 		},
 		ClosedConnection: func(odcid logging.ConnectionID, err error) {
-			log.Infof("closed QUIC connection %s", odcid.String())
+			log.WithField("odcid", odcid.String()).Infof("closed QUIC connection %s", odcid.String())
+			metrics.connections.ClosedConnection(odcid)
 		},
+		HandshakeConfirmed: metrics.connections.HandshakeConfirmed,
 	}))
 
+	if client.migrator != nil {
+		tracers = append(tracers, client.migrator.tracer())
+	}
+
 	if config.Qlog {
-		tracers = append(tracers, internal.NewQlogTracer(config.QlogPrefix, func(filename string) {
+		tracers = append(tracers, internal.NewQlogTracer(config.QlogConfig, func(filename string) {
 			log.Infof("created qlog file: %s", filename)
 		}))
 	}
@@ -85,6 +284,8 @@ func Run(config Config) error {
 		EnableActiveMigration: true,
 		AllowEarlyHandover:    config.AllowEarlyHandover,
 	}
+	config.TransportParameters.Apply(quicConf)
+	config.CongestionControl.Apply(quicConf)
 
 	if config.ExtraStreamEncryption {
 		quicConf.ExtraStreamEncryption = quic.EnforceExtraStreamEncryption
@@ -92,129 +293,447 @@ func Run(config Config) error {
 		quicConf.ExtraStreamEncryption = quic.DisableExtraStreamEncryption
 	}
 
-	roundTripper := &http3.RoundTripper{
-		TLSClientConfig: tlsConf,
-		QuicConfig:      quicConf,
+	newRoundTripper := func() *http3.RoundTripper {
+		roundTripper := &http3.RoundTripper{
+			TLSClientConfig: tlsConf,
+			QuicConfig:      quicConf,
+			// content encodings are negotiated and decoded by the client
+			DisableCompression: true,
+			EnableDatagrams:    config.TransportParameters.EnableDatagrams,
+		}
+		if pcap != nil || config.CongestionControl.Paced() {
+			roundTripper.Dial = func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+				return dialWrapped(ctx, addr, tlsCfg, cfg, func(conn net.PacketConn) net.PacketConn {
+					if pcap != nil {
+						conn = internal.NewCapturingPacketConn(conn, pcap)
+					}
+					// paced after the capture, so the capture has the send times
+					return config.CongestionControl.WrapPacketConn(conn)
+				})
+			}
+		}
+		return roundTripper
 	}
-	defer roundTripper.Close()
-
-	hclient := &http.Client{
-		Transport: roundTripper,
+	newHttpClient := func() (*http.Client, *connectionPool) {
+		pool := newConnectionPool(newRoundTripper, config.ConnectionsPerHost, config.NewConnectionPerRequest, config.MaxStreams)
+		return &http.Client{
+			Transport: pool,
+		}, pool
 	}
 
+	hclient, pool := newHttpClient()
+	defer pool.Close()
 	client.httpClient = hclient
+	client.segmentClients = []*http.Client{client.httpClient}
+	for i := 1; i < config.SegmentConnections; i++ {
+		segmentClient, segmentPool := newHttpClient()
+		defer segmentPool.Close()
+		client.segmentClients = append(client.segmentClients, segmentClient)
+	}
 
-	urlQueue := internal.NewDistinctChannel[u.URL](1024)
-
-	pendingRequests := internal.NewCondHelper(0)
+	client.urlQueue = internal.NewDistinctChannelFunc(1024, func(q queuedUrl) u.URL { return q.url })
+	client.pendingRequests = internal.NewCondHelper(0)
 
-	for _, url := range config.Urls {
-		distinct := urlQueue.Add(*url)
-		if distinct {
-			pendingRequests.UpdateState(func(s int) int { return s + 1 })
-		}
-	}
+	workerCtx, stopWorkers := context.WithCancel(ctx)
+	defer stopWorkers()
 
 	firstRequestTime := time.Now()
+	if client.migrator != nil {
+		client.migrator.start()
+		// the connections of this view are closed afterwards
+		defer client.migrator.stop()
+	}
 	for i := 0; i < config.ParallelRequests; i++ {
 		go func() {
 			for {
-				url := urlQueue.Next()
-				if client.isUrlIgnored(url) {
-					log.Infof("skip blacklisted url: %s", url.String())
-				} else {
-					receivedBytes, err := client.download(&url, func(url *u.URL) {
-						distinct := urlQueue.Add(*url)
-						if distinct {
-							pendingRequests.UpdateState(func(s int) int { return s + 1 })
-						}
-					})
-					client.totalReceivedBytes.Add(receivedBytes)
-					if err != nil {
-						log.Errorf("failed to download %s: %v", url.String(), err)
-					}
+				q, err := client.urlQueue.NextContext(workerCtx)
+				if err != nil {
+					return
 				}
-				pendingRequests.UpdateState(func(s int) int { return s - 1 })
+				client.process(ctx, q)
 			}
 		}()
 	}
 
-	pendingRequests.Wait(func(s int) bool { return s == 0 })
+	done := make(chan struct{})
+	go func() {
+		if config.Recursive {
+			client.pageQueue = internal.NewDistinctChannelFunc(config.MaxPages, func(p *page) u.URL { return p.url })
+			for _, url := range config.Urls {
+				client.enqueuePage(newPage(*url, 0))
+			}
+			client.navigate(ctx)
+		} else {
+			for _, url := range config.Urls {
+				p := newPage(*url, 0)
+				p.start = time.Now()
+				client.enqueue(*url, 0, p)
+			}
+		}
+		// returns if the run times out, so that the goroutine does not leak
+		if client.pendingRequests.WaitContext(ctx, func(s int) bool { return s == 0 }) == nil {
+			close(done)
+		}
+	}()
+
+	var runErr error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		runErr = fmt.Errorf("run timed out after %s", config.RunTimeout)
+	}
 
-	log.Infof("total bytes received: %d B, time: %.3f s, get requests: %d, http errors: %d, quic connections: %d", client.totalReceivedBytes.Load(), time.Now().Sub(firstRequestTime).Seconds(), client.totalGetRequests.Load(), client.totalHttpErrors.Load(), client.totalQuicConnections.Load())
+	totalTime := time.Now().Sub(firstRequestTime)
+	log.WithFields(log.Fields{
+		"bytes":            client.totalReceivedBytes.Load(),
+		"decoded_bytes":    client.totalDecodedBytes.Load(),
+		"duration":         totalTime.Seconds(),
+		"requests":         client.totalGetRequests.Load(),
+		"retries":          client.totalRetries.Load(),
+		"quic_connections": client.totalQuicConnections.Load(),
+	}).Infof("total bytes received: %d B, decoded: %d B, time: %.3f s, get requests: %d, retries: %d, failures: %s, quic connections: %d, congestion control: %s", client.totalReceivedBytes.Load(), client.totalDecodedBytes.Load(), totalTime.Seconds(), client.totalGetRequests.Load(), client.totalRetries.Load(), &client.failures, client.totalQuicConnections.Load(), config.CongestionControl)
+	if cache != nil {
+		log.Infof("cache hits: %d, not modified: %d", client.totalCacheHits.Load(), client.totalNotModified.Load())
+	}
+	log.Infof("requests per quic connection: %s", &client.connectionRequests)
+	if client.migrator != nil {
+		client.migrator.report()
+	}
 
-	return nil
+	return &Summary{
+		ReceivedBytes:     client.totalReceivedBytes.Load(),
+		DecodedBytes:      client.totalDecodedBytes.Load(),
+		Duration:          totalTime,
+		Requests:          client.totalGetRequests.Load(),
+		Retries:           client.totalRetries.Load(),
+		Failures:          client.failures.total(),
+		QuicConnections:   int64(client.totalQuicConnections.Load()),
+		CacheHits:         client.totalCacheHits.Load(),
+		NotModified:       client.totalNotModified.Load(),
+		CongestionControl: config.CongestionControl.String(),
+	}, runErr
 }
 
+// navigate loads the queued pages one after another, like a user following links.
+// returns when all pages are loaded or the context is done.
+func (c *client) navigate(ctx context.Context) {
+	for loaded := 0; ; loaded++ {
+		c.pageQueueMutex.Lock()
+		queuedPages := c.queuedPages
+		c.pageQueueMutex.Unlock()
+		if loaded == queuedPages {
+			return
+		}
+		p, err := c.pageQueue.NextContext(ctx)
+		if err != nil {
+			return
+		}
+		p.start = time.Now()
+		if !c.enqueue(p.url, 0, p) {
+			log.Infof("skip already downloaded page: %s", p.url.String())
+			continue
+		}
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// enqueuePage adds the page to the navigation queue, unless MaxPages is reached.
+// returns true if the page was added
+func (c *client) enqueuePage(p *page) bool {
+	c.pageQueueMutex.Lock()
+	defer c.pageQueueMutex.Unlock()
+	if c.queuedPages >= c.config.MaxPages {
+		return false
+	}
+	// does not block, because the queue is large enough for MaxPages
+	distinct := c.pageQueue.Add(p)
+	if distinct {
+		c.queuedPages++
+	}
+	return distinct
+}
+
+// enqueue adds the url to the download queue, unless it was already added before.
+// returns true if the url was added
+func (c *client) enqueue(url u.URL, depth int, p *page) bool {
+	p.addPending()
+	distinct := c.urlQueue.Add(queuedUrl{url: url, depth: depth, page: p})
+	if distinct {
+		c.pendingRequests.UpdateState(func(s int) int { return s + 1 })
+	} else {
+		c.finishPending(p)
+	}
+	return distinct
+}
+
+// process downloads the queued url and adds found requisites and links to the queues
+func (c *client) process(ctx context.Context, q queuedUrl) {
+	url := q.url
+	if reason := c.skipReason(&q); reason != "" {
+		log.Infof("skip %s url: %s", reason, url.String())
+	} else {
+		var onFindLink func(*u.URL)
+		if c.config.Recursive && q.depth == 0 && q.page.depth < c.config.MaxLinkDepth {
+			onFindLink = func(url *u.URL) {
+				c.enqueuePage(newPage(*url, q.page.depth+1))
+			}
+		}
+		segmented := c.config.Segments > 1 && q.depth == 0 && q.page.depth == 0
+		receivedBytes, err := c.downloadWithRetries(ctx, &url, segmented, func(url *u.URL) {
+			c.enqueue(*url, q.depth+1, q.page)
+		}, onFindLink)
+		c.totalReceivedBytes.Add(receivedBytes)
+		c.metrics.receivedBytes.Add(float64(receivedBytes))
+		q.page.requests.Add(1)
+		q.page.bytes.Add(receivedBytes)
+		if err != nil && ctx.Err() == nil {
+			category := c.failures.addError(err)
+			c.metrics.failure(category)
+			log.WithFields(log.Fields{"url": url.String(), "category": category.String(), "error": err}).Errorf("failed to download %s (%s): %v", url.String(), category, err)
+		}
+	}
+	c.finishPending(q.page)
+	c.pendingRequests.UpdateState(func(s int) int { return s - 1 })
+}
+
+// finishPending logs the page load time, when the last request of the page is finished
+func (c *client) finishPending(p *page) {
+	if p.finishPending() && p.requests.Load() > 0 && (c.config.PageRequisites || c.config.Recursive) {
+		log.WithFields(log.Fields{"url": p.url.String(), "requests": p.requests.Load(), "bytes": p.bytes.Load(), "duration": p.loadTime().Seconds()}).Infof("loaded page %s: %d requests, %d byte, %f s", p.url.String(), p.requests.Load(), p.bytes.Load(), p.loadTime().Seconds())
+	}
+}
+
+// downloadWithRetries repeats the download on transport errors.
+// The wait time between attempts starts at RetryBackoff and is doubled after every attempt.
+// return received bytes
+func (c *client) downloadWithRetries(ctx context.Context, url *u.URL, segmented bool, onFindRequisite func(*u.URL), onFindLink func(*u.URL)) (int64, error) {
+	download := c.download
+	if segmented {
+		download = c.downloadSegmented
+	}
+	backoff := c.config.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		received, err := download(ctx, url, onFindRequisite, onFindLink)
+		if err == nil || attempt > c.config.Retries || ctx.Err() != nil || !classifyError(err).isTransport() {
+			return received, err
+		}
+		c.totalRetries.Add(1)
+		c.metrics.retries.Inc()
+		log.WithFields(log.Fields{"url": url.String(), "attempt": attempt, "error": err}).Warnf("retry %s in %s (%d/%d): %v", url, backoff, attempt, c.config.Retries, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return received, err
+		}
+		backoff *= 2
+	}
+}
+
+// onFindLink is only called if not nil.
 // return received bytes
-func (c *client) download(url *u.URL, onFindRequisite func(*u.URL)) (int64, error) {
+func (c *client) download(ctx context.Context, url *u.URL, onFindRequisite func(*u.URL), onFindLink func(*u.URL)) (int64, error) {
+	var cached *cacheEntry
+	if c.cache != nil {
+		cached = c.cache.get(url.String())
+		if cached != nil && cached.isFresh() {
+			c.totalCacheHits.Add(1)
+			log.Infof("cached %s", url)
+			return 0, c.findRequisites(url, cached.contentType, cached.header, cached.body, onFindRequisite, onFindLink)
+		}
+	}
+
+	if c.config.RequestTimeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.RequestTimeout)
+		defer cancel()
+	}
 	c.totalGetRequests.Add(1)
-	log.Infof("GET %s", url)
+	c.metrics.requests.Inc()
+	log.WithField("url", url.String()).Infof("GET %s", url)
 	start := time.Now()
-	req, err := http.NewRequest("GET", url.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url.String(), nil)
 	if err != nil {
 		return 0, err
 	}
 	req.Header.Set("user-agent", c.config.UserAgent)
+	if c.config.AcceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", c.config.AcceptEncoding)
+	}
+	if cached != nil {
+		cached.setValidators(req.Header)
+	}
 	rsp, err := c.httpClient.Do(req)
 	if err != nil {
 		return 0, err
 	}
+	defer rsp.Body.Close()
+	c.connectionRequests.add(rsp)
+
+	var reader io.Reader = rsp.Body
+	if c.migrator != nil {
+		c.migrator.track(rsp)
+		reader = c.migrator.reader(reader)
+	}
+	wire := &internal.CountingReader{Reader: reader}
+	contentEncoding := rsp.Header.Get("Content-Encoding")
+	decoder, err := internal.NewContentDecoder(contentEncoding, wire)
+	if err != nil {
+		return 0, err
+	}
+	defer decoder.Close()
 
-	//TODO convert HTML and CSS with other encodings to UTF-8
 	contentType := strings.ToLower(strings.Split(rsp.Header.Get("Content-Type"), ";")[0])
+	notModified := cached != nil && rsp.StatusCode == http.StatusNotModified
+	if notModified {
+		contentType = cached.contentType
+	}
 
-	var received int64
-	var requisites []*u.URL
+	var body []byte
+	var decoded int64
 	var stop time.Time
 
-	if c.config.PageRequisites && contentType == internal.MIME_TYPE_TEXT_HTML {
-		html, err := io.ReadAll(rsp.Body)
-		if err != nil {
-			return 0, err
-		}
-		stop = time.Now()
-		received = int64(len(html))
-		requisites, err = r.GetHtmlRequisites(bytes.NewReader(html))
-		if err != nil {
-			return 0, err
-		}
-	} else if c.config.PageRequisites && contentType == internal.MIME_TYPE_TEXT_CSS {
-		css, err := io.ReadAll(rsp.Body)
+	if c.needsBody(contentType, onFindLink != nil) {
+		body, err = io.ReadAll(decoder)
 		if err != nil {
 			return 0, err
 		}
 		stop = time.Now()
-		received = int64(len(css))
-		requisites, err = r.GetCssRequisites(string(css))
+		decoded = int64(len(body))
+		body, err = decodeToUtf8(body, rsp.Header.Get("Content-Type"), contentType)
 		if err != nil {
-			return 0, err
+			return 0, fmt.Errorf("failed to decode %s: %w", contentType, err)
 		}
 	} else {
-		received, err = io.Copy(internal.DiscardWriter{}, rsp.Body)
+		decoded, err = io.Copy(internal.DiscardWriter{}, decoder)
 		if err != nil {
 			return 0, err
 		}
 		stop = time.Now()
 	}
+	received := wire.Count
+	c.totalDecodedBytes.Add(decoded)
+	c.metrics.decodedBytes.Add(float64(decoded))
+	c.metrics.requestDuration.Observe(stop.Sub(start).Seconds())
 
-	if isHttpStatusError(rsp.StatusCode) {
-		c.totalHttpErrors.Add(1)
+	header := rsp.Header
+	if notModified {
+		c.totalNotModified.Add(1)
+		cached.update(rsp.Header)
+		body = cached.body
+		header = cached.header
+	} else if isHttpStatusError(rsp.StatusCode) {
+		c.metrics.failure(c.failures.addStatus(rsp.StatusCode))
+	} else if c.cache != nil {
+		c.cache.store(url.String(), rsp, contentType, body)
+	}
+	fields := responseFields(url, rsp, received, stop.Sub(start))
+	if contentEncoding != "" {
+		fields["content_encoding"] = contentEncoding
+		fields["decoded_bytes"] = decoded
+		log.WithFields(fields).Infof("got %s %s %d, %d byte (%s, %d byte decoded), %f s, %s", url, rsp.Proto, rsp.StatusCode, received, contentEncoding, decoded, stop.Sub(start).Seconds(), requestLocation(rsp))
+	} else {
+		log.WithFields(fields).Infof("got %s %s %d, %d byte, %f s, %s", url, rsp.Proto, rsp.StatusCode, received, stop.Sub(start).Seconds(), requestLocation(rsp))
+	}
+
+	return received, c.findRequisites(url, contentType, header, body, onFindRequisite, onFindLink)
+}
+
+// needsBody returns true if requisites or links are extracted from the body
+func (c *client) needsBody(contentType string, findLinks bool) bool {
+	if c.config.PageRequisites && len(c.requisiteExtractors[contentType]) != 0 {
+		return true
+	}
+	return findLinks && contentType == internal.MIME_TYPE_TEXT_HTML
+}
+
+// findRequisites extracts requisites and links from the UTF-8 encoded body and the response header.
+// onFindLink is only called if not nil.
+func (c *client) findRequisites(url *u.URL, contentType string, header http.Header, body []byte, onFindRequisite func(*u.URL), onFindLink func(*u.URL)) error {
+	var requisites []*u.URL
+	var links []*u.URL
+
+	if c.config.PageRequisites && body != nil {
+		for _, extract := range c.requisiteExtractors[contentType] {
+			found, err := extract(body)
+			if err != nil {
+				return err
+			}
+			requisites = append(requisites, found...)
+		}
+	}
+	if c.config.PageRequisites {
+		requisites = append(requisites, getLinkHeaderRequisites(header)...)
+	}
+	if onFindLink != nil && body != nil && contentType == internal.MIME_TYPE_TEXT_HTML {
+		var err error
+		links, err = getHtmlLinks(bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
 	}
-	log.Infof("got %s %s %d, %d byte, %f s", url, rsp.Proto, rsp.StatusCode, received, stop.Sub(start).Seconds())
 
 	for _, requisite := range requisites {
 		absolute := url.ResolveReference(requisite)
 		onFindRequisite(absolute)
 	}
 
-	return received, nil
+	for _, link := range links {
+		absolute := url.ResolveReference(link)
+		absolute.Fragment = ""
+		onFindLink(absolute)
+	}
+
+	return nil
+}
+
+// responseFields returns the structured log fields of a response
+func responseFields(url *u.URL, rsp *http.Response, received int64, duration time.Duration) log.Fields {
+	fields := log.Fields{
+		"url":      url.String(),
+		"proto":    rsp.Proto,
+		"status":   rsp.StatusCode,
+		"bytes":    received,
+		"duration": duration.Seconds(),
+	}
+	if odcid, ok := connectionID(rsp); ok {
+		fields["odcid"] = odcid
+	}
+	if id, ok := streamID(rsp); ok {
+		fields["stream_id"] = int64(id)
+	}
+	return fields
 }
 
 func isHttpStatusError(statusCode int) bool {
 	return statusCode < 200 || statusCode >= 300
 }
 
+// skipReason returns why the url should not be requested.
+// returns an empty string if the url should be requested.
+// counts the url towards MaxRequests if it is not skipped otherwise.
+func (c *client) skipReason(q *queuedUrl) string {
+	if c.isUrlIgnored(q.url) {
+		return "blacklisted"
+	}
+	if !c.isUrlAllowed(q.url) {
+		return "not allowlisted"
+	}
+	if c.config.MaxDepth >= 0 && q.depth > c.config.MaxDepth {
+		return "too deep"
+	}
+	if (q.depth > 0 || q.page.depth > 0) && !c.isHostInScope(q.url.Hostname()) {
+		return "out of scope"
+	}
+	if c.config.MaxRequests > 0 && c.startedRequests.Add(1) > int64(c.config.MaxRequests) {
+		return "over request limit"
+	}
+	return ""
+}
+
 func (c *client) isUrlIgnored(url u.URL) bool {
 	for _, regex := range c.config.UrlBlacklist {
 		if regex.MatchString(url.String()) {
@@ -223,3 +742,31 @@ func (c *client) isUrlIgnored(url u.URL) bool {
 	}
 	return false
 }
+
+func (c *client) isUrlAllowed(url u.URL) bool {
+	if len(c.config.UrlAllowlist) == 0 {
+		return true
+	}
+	for _, regex := range c.config.UrlAllowlist {
+		if regex.MatchString(url.String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHostInScope checks the host against SpanHosts and Domains
+func (c *client) isHostInScope(host string) bool {
+	if c.config.SpanHosts && len(c.config.Domains) == 0 {
+		return true
+	}
+	if !c.config.SpanHosts && c.initialHosts[host] {
+		return true
+	}
+	for _, domain := range c.config.Domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
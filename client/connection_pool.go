@@ -0,0 +1,259 @@
+package client
+
+import (
+	"fmt"
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/http3"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// connectionPool is a http.RoundTripper distributing requests round-robin over a fixed number of connections per host.
+// Each connection is a separate http3.RoundTripper, that reconnects on demand.
+type connectionPool struct {
+	newRoundTripper    func() *http3.RoundTripper
+	connectionsPerHost int
+	// open a new connection for every request, that is closed after the response
+	newConnectionPerRequest bool
+	// maximum number of concurrent requests per connection.
+	// 0 means unlimited
+	maxStreams int
+	mutex      sync.Mutex
+	hosts      map[string]*hostConnections
+}
+
+type hostConnections struct {
+	connections []*pooledConnection
+	// index of the next connection in round-robin order
+	next int
+	// semaphore of the free streams of all connections; nil if unlimited
+	streams chan struct{}
+}
+
+type pooledConnection struct {
+	roundTripper *http3.RoundTripper
+	// concurrent requests, guarded by the mutex of the pool
+	activeStreams int
+}
+
+func newConnectionPool(newRoundTripper func() *http3.RoundTripper, connectionsPerHost int, newConnectionPerRequest bool, maxStreams int) *connectionPool {
+	if connectionsPerHost < 1 {
+		connectionsPerHost = 1
+	}
+	return &connectionPool{
+		newRoundTripper:         newRoundTripper,
+		connectionsPerHost:      connectionsPerHost,
+		newConnectionPerRequest: newConnectionPerRequest,
+		maxStreams:              maxStreams,
+		hosts:                   make(map[string]*hostConnections),
+	}
+}
+
+func (p *connectionPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	if p.newConnectionPerRequest {
+		roundTripper := p.newRoundTripper()
+		rsp, err := roundTripper.RoundTrip(req)
+		if err != nil {
+			roundTripper.Close()
+			return nil, err
+		}
+		rsp.Body = &pooledBody{ReadCloser: rsp.Body, onClose: func() { roundTripper.Close() }}
+		return rsp, nil
+	}
+
+	conn, release, err := p.acquire(req)
+	if err != nil {
+		return nil, err
+	}
+	rsp, err := conn.roundTripper.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	rsp.Body = &pooledBody{ReadCloser: rsp.Body, onClose: release}
+	return rsp, nil
+}
+
+// acquire selects the next connection of the host in round-robin order.
+// If MaxStreams is set, the next connection with a free stream is selected,
+// or it is waited until any connection of the host frees a stream.
+// The returned function releases the stream
+func (p *connectionPool) acquire(req *http.Request) (*pooledConnection, func(), error) {
+	p.mutex.Lock()
+	host, ok := p.hosts[req.URL.Host]
+	if !ok {
+		host = &hostConnections{}
+		for i := 0; i < p.connectionsPerHost; i++ {
+			host.connections = append(host.connections, &pooledConnection{roundTripper: p.newRoundTripper()})
+		}
+		if p.maxStreams > 0 {
+			host.streams = make(chan struct{}, p.maxStreams*p.connectionsPerHost)
+		}
+		p.hosts[req.URL.Host] = host
+	}
+	p.mutex.Unlock()
+
+	if host.streams != nil {
+		select {
+		case host.streams <- struct{}{}:
+		case <-req.Context().Done():
+			return nil, nil, req.Context().Err()
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for i := 0; i < len(host.connections); i++ {
+		index := (host.next + i) % len(host.connections)
+		conn := host.connections[index]
+		if p.maxStreams <= 0 || conn.activeStreams < p.maxStreams {
+			host.next = (index + 1) % len(host.connections)
+			conn.activeStreams++
+			return conn, func() { p.release(host, conn) }, nil
+		}
+	}
+	// not reached, the semaphore guarantees a free stream
+	if host.streams != nil {
+		<-host.streams
+	}
+	return nil, nil, fmt.Errorf("no free stream to %s", req.URL.Host)
+}
+
+func (p *connectionPool) release(host *hostConnections, conn *pooledConnection) {
+	p.mutex.Lock()
+	conn.activeStreams--
+	p.mutex.Unlock()
+	// after the stream is free, so that the next request finds it
+	if host.streams != nil {
+		<-host.streams
+	}
+}
+
+// Close closes all connections of the pool
+func (p *connectionPool) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, host := range p.hosts {
+		for _, conn := range host.connections {
+			conn.roundTripper.Close()
+		}
+	}
+	p.hosts = make(map[string]*hostConnections)
+	return nil
+}
+
+// pooledBody calls onClose once, when the body is closed
+type pooledBody struct {
+	io.ReadCloser
+	onClose func()
+	once    sync.Once
+}
+
+func (b *pooledBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.onClose)
+	return err
+}
+
+// StreamCreator passes through the connection of the inner body
+func (b *pooledBody) StreamCreator() http3.StreamCreator {
+	if hijacker, ok := b.ReadCloser.(http3.Hijacker); ok {
+		return hijacker.StreamCreator()
+	}
+	return nil
+}
+
+// StreamID passes through the stream of the inner body
+func (b *pooledBody) StreamID() quic.StreamID {
+	if s, ok := b.ReadCloser.(streamIDer); ok {
+		return s.StreamID()
+	}
+	return -1
+}
+
+// connectionRequestCounters counts requests per QUIC connection, in the order the connections are first used
+type connectionRequestCounters struct {
+	mutex  sync.Mutex
+	ids    []string
+	counts map[string]int
+}
+
+// add counts the request of the response, if the connection is known
+func (c *connectionRequestCounters) add(rsp *http.Response) {
+	id, ok := connectionID(rsp)
+	if !ok {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[string]int)
+	}
+	if _, ok := c.counts[id]; !ok {
+		c.ids = append(c.ids, id)
+	}
+	c.counts[id]++
+}
+
+// String returns the counters, e.g. "70058277a154: 3, 58ec41b19fe4: 2"
+func (c *connectionRequestCounters) String() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.ids) == 0 {
+		return "none"
+	}
+	parts := make([]string, 0, len(c.ids))
+	for _, id := range c.ids {
+		parts = append(parts, fmt.Sprintf("%s: %d", id, c.counts[id]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// connectionID returns the original destination connection ID of the QUIC connection the response was received on
+func connectionID(rsp *http.Response) (string, bool) {
+	conn, ok := responseConnection(rsp)
+	if !ok {
+		return "", false
+	}
+	return conn.OriginalDestinationConnectionID().String(), true
+}
+
+// streamIDer is implemented by the response bodies of http3
+type streamIDer interface {
+	StreamID() quic.StreamID
+}
+
+// streamID returns the QUIC stream the response was received on
+func streamID(rsp *http.Response) (quic.StreamID, bool) {
+	s, ok := rsp.Body.(streamIDer)
+	if !ok || s.StreamID() < 0 {
+		return 0, false
+	}
+	return s.StreamID(), true
+}
+
+// requestLocation returns the QUIC connection and stream of the response, e.g. "connection 1a2b, stream 4",
+// to cross-reference log lines and qlog files
+func requestLocation(rsp *http.Response) string {
+	odcid, ok := connectionID(rsp)
+	if !ok {
+		return "unknown connection"
+	}
+	id, ok := streamID(rsp)
+	if !ok {
+		return fmt.Sprintf("connection %s", odcid)
+	}
+	return fmt.Sprintf("connection %s, stream %d", odcid, id)
+}
+
+// responseConnection returns the QUIC connection the response was received on
+func responseConnection(rsp *http.Response) (quic.Connection, bool) {
+	hijacker, ok := rsp.Body.(http3.Hijacker)
+	if !ok {
+		return nil, false
+	}
+	conn, ok := hijacker.StreamCreator().(quic.Connection)
+	return conn, ok
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/lucas-clemente/quic-go/http3"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestPool(connectionsPerHost int, maxStreams int) *connectionPool {
+	return newConnectionPool(func() *http3.RoundTripper { return &http3.RoundTripper{} }, connectionsPerHost, false, maxStreams)
+}
+
+func indexOf(pool *connectionPool, host string, conn *pooledConnection) int {
+	for i, c := range pool.hosts[host].connections {
+		if c == conn {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestConnectionPoolRoundRobin(t *testing.T) {
+	pool := newTestPool(3, 0)
+	defer pool.Close()
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	for i, expected := range []int{0, 1, 2, 0, 1} {
+		conn, _, err := pool.acquire(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if index := indexOf(pool, "example.com", conn); index != expected {
+			t.Errorf("expected connection %d for request %d, got %d", expected, i, index)
+		}
+	}
+	for i, expected := range []int{2, 2, 1} {
+		if active := pool.hosts["example.com"].connections[i].activeStreams; active != expected {
+			t.Errorf("expected %d active streams on connection %d, got %d", expected, i, active)
+		}
+	}
+	other := httptest.NewRequest(http.MethodGet, "https://other.com/", nil)
+	conn, _, _ := pool.acquire(other)
+	if index := indexOf(pool, "other.com", conn); index != 0 {
+		t.Errorf("expected the first connection of another host, got %d", index)
+	}
+}
+
+func TestConnectionPoolMaxStreams(t *testing.T) {
+	pool := newTestPool(2, 1)
+	defer pool.Close()
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	first, releaseFirst, _ := pool.acquire(req)
+	second, releaseSecond, _ := pool.acquire(req)
+	if first == second {
+		t.Fatalf("expected different connections")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err := pool.acquire(req.WithContext(ctx))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected to wait for a free stream, got %v", err)
+	}
+
+	// the next connection in round-robin order is the first, but the second frees a stream
+	acquired := make(chan *pooledConnection)
+	go func() {
+		conn, _, _ := pool.acquire(req)
+		acquired <- conn
+	}()
+	time.Sleep(10 * time.Millisecond)
+	releaseSecond()
+	select {
+	case conn := <-acquired:
+		if conn != second {
+			t.Errorf("expected the connection that freed a stream")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected to acquire the freed stream of any connection")
+	}
+	releaseFirst()
+	if first.activeStreams != 0 || second.activeStreams != 1 {
+		t.Errorf("expected 0 and 1 active streams, got %d and %d", first.activeStreams, second.activeStreams)
+	}
+}
@@ -0,0 +1,282 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/PuerkitoBio/goquery"
+	r "github.com/birneee/webpage-requisites-go"
+	"golang.org/x/exp/slices"
+	"http-perf-go/internal"
+	"net/http"
+	u "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// requisiteExtractor finds the requisites in the body of a response.
+// might return duplicates
+type requisiteExtractor func(body []byte) ([]*u.URL, error)
+
+// requisiteExtractors maps content types to the extractors that are applied to the response body
+type requisiteExtractors map[string][]requisiteExtractor
+
+func defaultRequisiteExtractors() requisiteExtractors {
+	return requisiteExtractors{
+		internal.MIME_TYPE_TEXT_HTML:                 {getHtmlRequisites, getHtmlHintRequisites},
+		internal.MIME_TYPE_TEXT_CSS:                  {getCssRequisites},
+		internal.MIME_TYPE_APPLICATION_JAVASCRIPT:    {getJsImports},
+		internal.MIME_TYPE_TEXT_JAVASCRIPT:           {getJsImports},
+		internal.MIME_TYPE_APPLICATION_MANIFEST_JSON: {getManifestRequisites},
+	}
+}
+
+func getHtmlRequisites(body []byte) ([]*u.URL, error) {
+	return r.GetHtmlRequisites(bytes.NewReader(body))
+}
+
+func getCssRequisites(body []byte) ([]*u.URL, error) {
+	return r.GetCssRequisites(string(body))
+}
+
+// resource hints that are fetched by browsers
+var hintRelations = []string{"preload", "modulepreload", "prefetch"}
+
+// link relations of Link headers that are fetched by browsers
+var linkHeaderRelations = append([]string{"stylesheet"}, hintRelations...)
+
+// getHtmlHintRequisites finds the requisites not covered by webpage-requisites-go:
+// resource hints, the best srcset candidates and imports of inline module scripts
+func getHtmlHintRequisites(body []byte) ([]*u.URL, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]*u.URL, 0)
+
+	doc.Find("link[href]").Each(func(_ int, selection *goquery.Selection) {
+		rel, _ := selection.Attr("rel")
+		if !containsAnyRelation(rel, hintRelations) {
+			return
+		}
+		href, _ := selection.Attr("href")
+		if url := parseRequisiteUrl(href); url != nil {
+			urls = append(urls, url)
+		}
+	})
+
+	doc.Find("img[srcset], source[srcset]").Each(func(_ int, selection *goquery.Selection) {
+		srcset, _ := selection.Attr("srcset")
+		if url := bestSrcsetCandidate(srcset); url != nil {
+			urls = append(urls, url)
+		}
+	})
+
+	doc.Find("script:not([src])").Each(func(_ int, selection *goquery.Selection) {
+		scriptType, _ := selection.Attr("type")
+		if strings.ToLower(scriptType) != "module" {
+			return
+		}
+		imports, err := getJsImports([]byte(selection.Text()))
+		if err != nil {
+			return
+		}
+		urls = append(urls, imports...)
+	})
+
+	return urls, nil
+}
+
+// bestSrcsetCandidate returns the candidate with the highest width or pixel density,
+// like a browser on a high resolution display would choose.
+// width and density descriptors are not comparable, so width descriptors are preferred.
+// candidates without descriptor have a density of 1x.
+// returns nil if there is no valid candidate
+func bestSrcsetCandidate(srcset string) *u.URL {
+	var bestWidth, bestDensity *u.URL
+	var maxWidth, maxDensity float64
+	for _, candidate := range parseSrcset(srcset) {
+		url := parseRequisiteUrl(candidate.url)
+		if url == nil {
+			continue
+		}
+		descriptor := "1x"
+		for _, d := range candidate.descriptors {
+			// height descriptors only accompany width descriptors
+			if !strings.HasSuffix(d, "h") {
+				descriptor = d
+				break
+			}
+		}
+		size, err := strconv.ParseFloat(descriptor[:len(descriptor)-1], 64)
+		if err != nil {
+			continue
+		}
+		switch descriptor[len(descriptor)-1] {
+		case 'w':
+			if bestWidth == nil || size > maxWidth {
+				bestWidth, maxWidth = url, size
+			}
+		case 'x':
+			if bestDensity == nil || size > maxDensity {
+				bestDensity, maxDensity = url, size
+			}
+		}
+	}
+	if bestWidth != nil {
+		return bestWidth
+	}
+	return bestDensity
+}
+
+type srcsetCandidate struct {
+	url         string
+	descriptors []string
+}
+
+// parseSrcset splits a srcset attribute into candidates like the HTML srcset parsing algorithm.
+// The url runs up to whitespace, so that urls may contain commas, e.g. of image CDNs.
+// The descriptors run up to the next comma outside of parentheses
+func parseSrcset(srcset string) []srcsetCandidate {
+	isSpace := func(c byte) bool {
+		return strings.IndexByte(" \t\n\f\r", c) >= 0
+	}
+	candidates := make([]srcsetCandidate, 0)
+	for pos := 0; pos < len(srcset); pos++ {
+		for pos < len(srcset) && (isSpace(srcset[pos]) || srcset[pos] == ',') {
+			pos++
+		}
+		if pos == len(srcset) {
+			break
+		}
+		start := pos
+		for pos < len(srcset) && !isSpace(srcset[pos]) {
+			pos++
+		}
+		url := srcset[start:pos]
+		if strings.HasSuffix(url, ",") {
+			// a trailing comma ends the candidate without descriptors
+			candidates = append(candidates, srcsetCandidate{url: strings.TrimRight(url, ",")})
+			pos--
+			continue
+		}
+		start = pos
+		inParens := false
+		for ; pos < len(srcset); pos++ {
+			if srcset[pos] == '(' {
+				inParens = true
+			} else if srcset[pos] == ')' {
+				inParens = false
+			} else if srcset[pos] == ',' && !inParens {
+				break
+			}
+		}
+		candidates = append(candidates, srcsetCandidate{url: url, descriptors: strings.Fields(srcset[start:pos])})
+	}
+	return candidates
+}
+
+// static imports, re-exports and dynamic imports with string literals
+var jsImportRegexp = regexp.MustCompile(`(?:\bimport|\bexport)\s*(?:[\w$*{}\s,]*?\bfrom\s*)?["']([^"'\n]+)["']|\bimport\s*\(\s*["']([^"'\n]+)["']\s*\)`)
+
+// getJsImports finds the ES modules imported by a script.
+// bare module specifiers are skipped, because they require an import map
+func getJsImports(body []byte) ([]*u.URL, error) {
+	urls := make([]*u.URL, 0)
+	for _, match := range jsImportRegexp.FindAllSubmatch(body, -1) {
+		specifier := string(match[1])
+		if specifier == "" {
+			specifier = string(match[2])
+		}
+		if !isUrlModuleSpecifier(specifier) {
+			continue
+		}
+		if url := parseRequisiteUrl(specifier); url != nil {
+			urls = append(urls, url)
+		}
+	}
+	return urls, nil
+}
+
+func isUrlModuleSpecifier(specifier string) bool {
+	for _, prefix := range []string{"/", "./", "../", "http://", "https://"} {
+		if strings.HasPrefix(specifier, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type webAppManifest struct {
+	Icons []struct {
+		Src string `json:"src"`
+	} `json:"icons"`
+}
+
+// getManifestRequisites finds the icons of a web app manifest
+func getManifestRequisites(body []byte) ([]*u.URL, error) {
+	var manifest webAppManifest
+	err := json.Unmarshal(body, &manifest)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]*u.URL, 0)
+	for _, icon := range manifest.Icons {
+		if url := parseRequisiteUrl(icon.Src); url != nil {
+			urls = append(urls, url)
+		}
+	}
+	return urls, nil
+}
+
+// getLinkHeaderRequisites finds resource hints and stylesheets in Link response headers
+func getLinkHeaderRequisites(header http.Header) []*u.URL {
+	urls := make([]*u.URL, 0)
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			var rel string
+			for _, param := range parts[1:] {
+				name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+				if found && strings.ToLower(name) == "rel" {
+					rel = strings.Trim(value, `"`)
+				}
+			}
+			if !containsAnyRelation(rel, linkHeaderRelations) {
+				continue
+			}
+			if url := parseRequisiteUrl(target[1 : len(target)-1]); url != nil {
+				urls = append(urls, url)
+			}
+		}
+	}
+	return urls
+}
+
+// containsAnyRelation checks if the space separated list of link relations contains one of the relations
+func containsAnyRelation(rel string, relations []string) bool {
+	for _, r := range strings.Fields(strings.ToLower(rel)) {
+		if slices.Contains(relations, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRequisiteUrl returns nil for invalid urls and embedded data
+func parseRequisiteUrl(raw string) *u.URL {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.HasPrefix(strings.ToLower(raw), "data:") {
+		return nil
+	}
+	url, err := u.Parse(raw)
+	if err != nil {
+		return nil
+	}
+	return url
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"net/http"
+	u "net/url"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func urlStrings(urls []*u.URL) []string {
+	strs := make([]string, 0, len(urls))
+	for _, url := range urls {
+		strs = append(strs, url.String())
+	}
+	sort.Strings(strs)
+	return strs
+}
+
+func expectUrls(t *testing.T, urls []*u.URL, expected ...string) {
+	actual := urlStrings(urls)
+	sort.Strings(expected)
+	if len(actual) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+		return
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, actual)
+			return
+		}
+	}
+}
+
+func TestHtmlHintRequisites(t *testing.T) {
+	html := `<html><head>
+		<link rel="preload" href="font.woff2" as="font">
+		<link rel="modulepreload" href="/app.js">
+		<link rel="stylesheet" href="ignored.css">
+		<script type="module">import { a } from "./a.js"; import "lodash";</script>
+	</head><body>
+		<img src="small.png" srcset="small.png 1x, large.png 2x">
+		<picture><source srcset="a-480.webp 480w, a-960.webp 960w"></picture>
+	</body></html>`
+	urls, err := getHtmlHintRequisites([]byte(html))
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	expectUrls(t, urls, "font.woff2", "/app.js", "./a.js", "large.png", "a-960.webp")
+}
+
+func TestBestSrcsetCandidate(t *testing.T) {
+	cases := map[string]string{
+		"small.png 1x, large.png 2x":                           "large.png",
+		"a-480.webp 480w, a-960.webp 960w":                     "a-960.webp",
+		"retina.png 2x, wide.png 480w":                         "wide.png",
+		"default.png, large.png 2x":                            "large.png",
+		"default.png, small.png 0.5x":                          "default.png",
+		"invalid.png 2y, fallback.png":                         "fallback.png",
+		"a-960.webp 960w, a-480.webp 480w, b.png":              "a-960.webp",
+		"/w_400,c_scale/a.jpg 400w, /w_800,c_scale/a.jpg 800w": "/w_800,c_scale/a.jpg",
+		"a.png,b.png 2x":                                       "a.png,b.png",
+		"a.png, b.png 2x,":                                     "b.png",
+		"a.png 480w 300h, b.png 240w":                          "a.png",
+	}
+	for srcset, expected := range cases {
+		best := bestSrcsetCandidate(srcset)
+		if best == nil || best.String() != expected {
+			t.Errorf("expected %s for %q, got %v", expected, srcset, best)
+		}
+	}
+	if bestSrcsetCandidate(" , ") != nil {
+		t.Errorf("expected no candidate")
+	}
+}
+
+func TestParseSrcset(t *testing.T) {
+	candidates := parseSrcset(" /w_400,c_scale/a.jpg 400w,/b.jpg, c.jpg 2x (future, descriptor),d.jpg")
+	expected := []srcsetCandidate{
+		{url: "/w_400,c_scale/a.jpg", descriptors: []string{"400w"}},
+		{url: "/b.jpg"},
+		{url: "c.jpg", descriptors: []string{"2x", "(future,", "descriptor)"}},
+		{url: "d.jpg"},
+	}
+	if len(candidates) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, candidates)
+	}
+	for i := range expected {
+		if candidates[i].url != expected[i].url || strings.Join(candidates[i].descriptors, " ") != strings.Join(expected[i].descriptors, " ") {
+			t.Errorf("expected %v, got %v", expected[i], candidates[i])
+		}
+	}
+}
+
+func TestJsImports(t *testing.T) {
+	js := `import def, { a as b } from './b.js';
+import * as c from "../c.js"
+import "https://example.com/d.js";
+export { e } from '/e.js';
+const f = await import('./f.js');
+import React from "react";`
+	urls, err := getJsImports([]byte(js))
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	expectUrls(t, urls, "./b.js", "../c.js", "https://example.com/d.js", "/e.js", "./f.js")
+}
+
+func TestManifestRequisites(t *testing.T) {
+	manifest := `{"name": "app", "icons": [{"src": "icon-192.png", "sizes": "192x192"}, {"src": "/icon-512.png"}]}`
+	urls, err := getManifestRequisites([]byte(manifest))
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	expectUrls(t, urls, "icon-192.png", "/icon-512.png")
+}
+
+func TestLinkHeaderRequisites(t *testing.T) {
+	header := http.Header{}
+	header.Add("Link", `</style.css>; rel=preload; as=style, <https://cdn.example.com>; rel=preconnect`)
+	header.Add("Link", `</main.css>; rel="stylesheet"`)
+	expectUrls(t, getLinkHeaderRequisites(header), "/style.css", "/main.css")
+}
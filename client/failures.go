@@ -0,0 +1,192 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lucas-clemente/quic-go"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type failureCategory int
+
+const (
+	failureDNS failureCategory = iota
+	failureHandshakeTimeout
+	failureIdleTimeout
+	failureStreamReset
+	failureTransportError
+	failureConnectionClosed
+	failureNetwork
+	failureRequestTimeout
+	failureHttpClientError
+	failureHttpServerError
+	failureHttpOther
+	failureOther
+	numFailureCategories
+)
+
+func (c failureCategory) String() string {
+	switch c {
+	case failureDNS:
+		return "dns"
+	case failureHandshakeTimeout:
+		return "handshake timeout"
+	case failureIdleTimeout:
+		return "idle timeout"
+	case failureStreamReset:
+		return "stream reset"
+	case failureTransportError:
+		return "transport error"
+	case failureConnectionClosed:
+		return "connection closed"
+	case failureNetwork:
+		return "network"
+	case failureRequestTimeout:
+		return "request timeout"
+	case failureHttpClientError:
+		return "http 4xx"
+	case failureHttpServerError:
+		return "http 5xx"
+	case failureHttpOther:
+		return "http other"
+	default:
+		return "other"
+	}
+}
+
+// classifyError maps a transport error returned by the HTTP client to a failure category
+func classifyError(err error) failureCategory {
+	var dnsErr *net.DNSError
+	var handshakeTimeoutErr *quic.HandshakeTimeoutError
+	var idleTimeoutErr *quic.IdleTimeoutError
+	var streamErr *quic.StreamError
+	var transportErr *quic.TransportError
+	var applicationErr *quic.ApplicationError
+	var statelessResetErr *quic.StatelessResetError
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &dnsErr):
+		return failureDNS
+	case errors.As(err, &handshakeTimeoutErr):
+		return failureHandshakeTimeout
+	case errors.As(err, &idleTimeoutErr):
+		return failureIdleTimeout
+	case errors.As(err, &streamErr):
+		return failureStreamReset
+	case errors.As(err, &transportErr):
+		return failureTransportError
+	case errors.As(err, &applicationErr), errors.As(err, &statelessResetErr):
+		return failureConnectionClosed
+	case errors.As(err, &opErr):
+		return failureNetwork
+	case errors.Is(err, context.DeadlineExceeded):
+		return failureRequestTimeout
+	default:
+		return failureOther
+	}
+}
+
+// isTransport returns true for failures of the network, the QUIC connection or stream, and request timeouts,
+// that may succeed when retried
+func (c failureCategory) isTransport() bool {
+	switch c {
+	case failureDNS, failureHandshakeTimeout, failureIdleTimeout, failureStreamReset, failureTransportError, failureConnectionClosed, failureNetwork, failureRequestTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// classifyStatus maps a non-successful HTTP status code to a failure category
+func classifyStatus(statusCode int) failureCategory {
+	switch {
+	case statusCode >= 400 && statusCode < 500:
+		return failureHttpClientError
+	case statusCode >= 500 && statusCode < 600:
+		return failureHttpServerError
+	default:
+		return failureHttpOther
+	}
+}
+
+// failureCounters counts failures per category.
+// Stream resets are additionally counted per error code.
+type failureCounters struct {
+	categories        [numFailureCategories]atomic.Int64
+	streamResetsMutex sync.Mutex
+	streamResets      map[quic.StreamErrorCode]int64
+}
+
+func (f *failureCounters) addError(err error) failureCategory {
+	category := classifyError(err)
+	f.categories[category].Add(1)
+	var streamErr *quic.StreamError
+	if category == failureStreamReset && errors.As(err, &streamErr) {
+		f.streamResetsMutex.Lock()
+		if f.streamResets == nil {
+			f.streamResets = make(map[quic.StreamErrorCode]int64)
+		}
+		f.streamResets[streamErr.ErrorCode]++
+		f.streamResetsMutex.Unlock()
+	}
+	return category
+}
+
+func (f *failureCounters) addStatus(statusCode int) failureCategory {
+	category := classifyStatus(statusCode)
+	f.categories[category].Add(1)
+	return category
+}
+
+func (f *failureCounters) total() int64 {
+	var total int64
+	for i := range f.categories {
+		total += f.categories[i].Load()
+	}
+	return total
+}
+
+func (f *failureCounters) load(category failureCategory) int64 {
+	return f.categories[category].Load()
+}
+
+// String returns all non-zero counters, e.g. "dns: 1, stream reset: 2 (code 0x10c: 2)"
+func (f *failureCounters) String() string {
+	parts := make([]string, 0)
+	for i := range f.categories {
+		category := failureCategory(i)
+		count := f.categories[i].Load()
+		if count == 0 {
+			continue
+		}
+		if category == failureStreamReset {
+			parts = append(parts, fmt.Sprintf("%s: %d (%s)", category, count, f.streamResetCodes()))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s: %d", category, count))
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (f *failureCounters) streamResetCodes() string {
+	f.streamResetsMutex.Lock()
+	defer f.streamResetsMutex.Unlock()
+	codes := make([]quic.StreamErrorCode, 0, len(f.streamResets))
+	for code := range f.streamResets {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	parts := make([]string, 0, len(codes))
+	for _, code := range codes {
+		parts = append(parts, fmt.Sprintf("code %#x: %d", uint64(code), f.streamResets[code]))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lucas-clemente/quic-go"
+	"net"
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := map[error]failureCategory{
+		fmt.Errorf("get: %w", &net.DNSError{Err: "no such host", Name: "example.invalid"}):                 failureDNS,
+		fmt.Errorf("get: %w", &quic.HandshakeTimeoutError{}):                                               failureHandshakeTimeout,
+		fmt.Errorf("get: %w", &quic.IdleTimeoutError{}):                                                    failureIdleTimeout,
+		fmt.Errorf("read: %w", &quic.StreamError{StreamID: 4, ErrorCode: 0x10c}):                           failureStreamReset,
+		fmt.Errorf("get: %w", &quic.TransportError{ErrorCode: quic.ProtocolViolation}):                     failureTransportError,
+		fmt.Errorf("get: %w", &quic.ApplicationError{Remote: true, ErrorCode: 0x102}):                      failureConnectionClosed,
+		fmt.Errorf("get: %w", &quic.StatelessResetError{}):                                                 failureConnectionClosed,
+		fmt.Errorf("get: %w", &net.OpError{Op: "read", Net: "udp", Err: errors.New("connection refused")}): failureNetwork,
+		fmt.Errorf("get: %w", &net.OpError{Op: "dial", Err: &net.DNSError{Name: "example.invalid"}}):       failureDNS,
+		fmt.Errorf("get: %w", context.DeadlineExceeded):                                                    failureRequestTimeout,
+		fmt.Errorf("something else"):                                                                       failureOther,
+	}
+	for err, expected := range cases {
+		if category := classifyError(err); category != expected {
+			t.Errorf("expected %s for %v, got %s", expected, err, category)
+		}
+	}
+}
+
+func TestIsTransport(t *testing.T) {
+	retried := map[error]bool{
+		fmt.Errorf("get: %w", &quic.IdleTimeoutError{}):                             true,
+		fmt.Errorf("read: %w", &quic.StreamError{StreamID: 4, ErrorCode: 0x10c}):    true,
+		fmt.Errorf("get: %w", context.DeadlineExceeded):                             true,
+		fmt.Errorf("get: %w", &quic.TransportError{ErrorCode: quic.InternalError}):  true,
+		fmt.Errorf("get: %w", &quic.ApplicationError{ErrorCode: 0x102}):             true,
+		fmt.Errorf("get: %w", &net.OpError{Op: "write", Err: errors.New("broken")}): true,
+		fmt.Errorf("unsupported content encoding: %s", "compress"):                  false,
+		fmt.Errorf("failed to decode %s: %w", "text/html", fmt.Errorf("charset")):   false,
+	}
+	for err, expected := range retried {
+		if classifyError(err).isTransport() != expected {
+			t.Errorf("expected transport %t for %v", expected, err)
+		}
+	}
+}
+
+func TestClassifyStatus(t *testing.T) {
+	if classifyStatus(404) != failureHttpClientError {
+		t.Errorf("404 must be a client error")
+	}
+	if classifyStatus(503) != failureHttpServerError {
+		t.Errorf("503 must be a server error")
+	}
+	if classifyStatus(304) != failureHttpOther {
+		t.Errorf("304 must be categorized as other")
+	}
+}
+
+func TestFailureCountersString(t *testing.T) {
+	var f failureCounters
+	if f.String() != "none" {
+		t.Errorf("expected none, got %s", f.String())
+	}
+	f.addError(&quic.StreamError{StreamID: 0, ErrorCode: 0x10c})
+	f.addStatus(500)
+	expected := "stream reset: 1 (code 0x10c: 1), http 5xx: 1"
+	if f.String() != expected {
+		t.Errorf("expected %s, got %s", expected, f.String())
+	}
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"io"
+	u "net/url"
+	"strings"
+)
+
+// getHtmlLinks returns the targets of all hyperlinks of the HTML document.
+// might return duplicates
+func getHtmlLinks(html io.Reader) ([]*u.URL, error) {
+	doc, err := goquery.NewDocumentFromReader(html)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]*u.URL, 0)
+
+	doc.Find("a, area").Each(func(_ int, selection *goquery.Selection) {
+		href, exists := selection.Attr("href")
+		if !exists {
+			return
+		}
+		href = strings.TrimSpace(href)
+		if href == "" || strings.HasPrefix(href, "#") {
+			return // link to the same page
+		}
+		url, err := u.Parse(href)
+		if err != nil {
+			return
+		}
+		if url.Scheme != "" && url.Scheme != "http" && url.Scheme != "https" {
+			return // e.g. mailto: or javascript:
+		}
+		urls = append(urls, url)
+	})
+
+	return urls, nil
+}
@@ -0,0 +1,29 @@
+package client
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetHtmlLinks(t *testing.T) {
+	cases := []struct {
+		html     string
+		expected []string
+	}{
+		{`<a href="a.html">a</a><a href="/b.html">b</a>`, []string{"a.html", "/b.html"}},
+		{`<a href=" https://example.com/c ">c</a>`, []string{"https://example.com/c"}},
+		{`<map><area href="d.html"></map>`, []string{"d.html"}},
+		{`<a href="a.html">a</a><a href="a.html">again</a>`, []string{"a.html", "a.html"}},
+		{`<a href="#top">top</a><a href="">empty</a><a>none</a>`, []string{}},
+		{`<a href="mailto:a@example.com">mail</a><a href="javascript:void(0)">js</a>`, []string{}},
+		{`<a href="http://[::1">invalid</a><link rel="next" href="next.html">`, []string{}},
+	}
+	for _, tc := range cases {
+		urls, err := getHtmlLinks(strings.NewReader(tc.html))
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+			continue
+		}
+		expectUrls(t, urls, tc.expected...)
+	}
+}
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"http-perf-go/internal"
+)
+
+const metricsPrefix = "http_perf_client"
+
+// clientMetrics are served by the metrics endpoint and kept over all views.
+// The counters are nil if the metrics endpoint is disabled, then they have no effect.
+type clientMetrics struct {
+	registry        internal.MetricsRegistry
+	requests        *internal.Counter
+	receivedBytes   *internal.Counter
+	decodedBytes    *internal.Counter
+	retries         *internal.Counter
+	requestDuration *internal.Histogram
+	connections     *internal.ConnectionMetrics
+}
+
+// newClientMetrics returns metrics without effect if registry is nil
+func newClientMetrics(registry internal.MetricsRegistry) *clientMetrics {
+	if registry == nil {
+		return &clientMetrics{}
+	}
+	return &clientMetrics{
+		registry:        registry,
+		requests:        registry.Counter(metricsPrefix+"_requests", "HTTP GET requests"),
+		receivedBytes:   registry.Counter(metricsPrefix+"_received_bytes", "received bytes of response bodies before decoding"),
+		decodedBytes:    registry.Counter(metricsPrefix+"_decoded_bytes", "bytes of decoded response bodies"),
+		retries:         registry.Counter(metricsPrefix+"_retries", "retried requests"),
+		requestDuration: registry.Histogram(metricsPrefix+"_request_duration_seconds", "duration from sending a request until the response body is read", internal.DefaultDurationBuckets),
+		connections:     internal.NewConnectionMetrics(registry, metricsPrefix),
+	}
+}
+
+func (m *clientMetrics) failure(category failureCategory) {
+	if m.registry == nil {
+		return
+	}
+	m.registry.Counter(metricsPrefix+"_errors", "failed requests by category", "category", category.String()).Inc()
+}
@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/logging"
+	log "github.com/sirupsen/logrus"
+	"http-perf-go/internal"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// resolution of the received bytes used to calculate the throughput around a migration
+const migrationThroughputBin = 10 * time.Millisecond
+
+// window before and after the migration to calculate the throughput
+const migrationThroughputWindow = 200 * time.Millisecond
+
+const noPacketNumber logging.PacketNumber = -1
+
+// migrator migrates the UDP sockets of all open QUIC connections once,
+// after a duration or after a number of received bytes,
+// and traces the connections to measure the migration latency and the throughput dip.
+// The latency is the time from the switch to the new UDP socket
+// until the peer acknowledges the first packet sent on the new path;
+// a receiving client mostly sends acknowledgments, that are only acknowledged together with the next ack-eliciting packet.
+type migrator struct {
+	afterDuration time.Duration
+	afterBytes    int64
+	receivedBytes atomic.Int64
+	once          sync.Once
+	mutex         sync.Mutex
+	connections   map[string]*migratedConnection
+	// in the order the connections are first used
+	ids []string
+	// counts the migrations, may be nil
+	metrics *internal.ConnectionMetrics
+	// the byte trigger fired
+	triggered atomic.Bool
+	// the duration trigger; nil if not armed
+	timer *time.Timer
+}
+
+type migratedConnection struct {
+	conn quic.Connection
+	// when the new UDP socket is used; zero if not migrated
+	migratedAt time.Time
+	// first 1-RTT packet sent on the new path, the old socket is closed by then.
+	// noPacketNumber if none was sent yet
+	firstPacketOnPath logging.PacketNumber
+	// the peer acknowledged a packet sent on the new path
+	acknowledgedAt time.Time
+	// received bytes per migrationThroughputBin
+	bins map[int64]int64
+}
+
+func newMigrator(afterDuration time.Duration, afterBytes int64, metrics *internal.ConnectionMetrics) *migrator {
+	return &migrator{
+		afterDuration: afterDuration,
+		afterBytes:    afterBytes,
+		connections:   make(map[string]*migratedConnection),
+		metrics:       metrics,
+	}
+}
+
+// start arms the duration trigger
+func (m *migrator) start() {
+	if m.afterDuration > 0 {
+		m.timer = time.AfterFunc(m.afterDuration, m.migrate)
+	}
+}
+
+// stop disarms the triggers, so that no connection is migrated after the view ended.
+// Waits for a running migration to start
+func (m *migrator) stop() {
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	m.once.Do(func() {})
+}
+
+func (m *migrator) connection(id string) *migratedConnection {
+	c, ok := m.connections[id]
+	if !ok {
+		c = &migratedConnection{firstPacketOnPath: noPacketNumber, bins: make(map[int64]int64)}
+		m.connections[id] = c
+		m.ids = append(m.ids, id)
+	}
+	return c
+}
+
+// track adds the QUIC connection of the response to the migrated connections
+func (m *migrator) track(rsp *http.Response) {
+	conn, ok := responseConnection(rsp)
+	if !ok {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.connection(conn.OriginalDestinationConnectionID().String()).conn = conn
+}
+
+// tracer returns the tracer of the connections, that records the events of the migration
+func (m *migrator) tracer() logging.Tracer {
+	return migrationTracer{migrator: m}
+}
+
+type migrationTracer struct {
+	logging.NullTracer
+	migrator *migrator
+}
+
+func (t migrationTracer) TracerForConnection(ctx context.Context, p logging.Perspective, odcid logging.ConnectionID) logging.ConnectionTracer {
+	t.migrator.mutex.Lock()
+	defer t.migrator.mutex.Unlock()
+	return &migrationConnectionTracer{migrator: t.migrator, connection: t.migrator.connection(odcid.String())}
+}
+
+type migrationConnectionTracer struct {
+	logging.NullConnectionTracer
+	migrator   *migrator
+	connection *migratedConnection
+}
+
+func (t *migrationConnectionTracer) SentPacket(hdr *logging.ExtendedHeader, size logging.ByteCount, ack *logging.AckFrame, frames []logging.Frame) {
+	if hdr.IsLongHeader {
+		return
+	}
+	t.migrator.mutex.Lock()
+	defer t.migrator.mutex.Unlock()
+	c := t.connection
+	if !c.migratedAt.IsZero() && c.firstPacketOnPath == noPacketNumber {
+		c.firstPacketOnPath = hdr.PacketNumber
+	}
+}
+
+func (t *migrationConnectionTracer) ReceivedShortHeaderPacket(hdr *logging.ShortHeader, size logging.ByteCount, frames []logging.Frame) {
+	now := time.Now()
+	t.migrator.mutex.Lock()
+	defer t.migrator.mutex.Unlock()
+	c := t.connection
+	c.bins[now.UnixNano()/int64(migrationThroughputBin)] += int64(size)
+	if c.firstPacketOnPath == noPacketNumber || !c.acknowledgedAt.IsZero() {
+		return
+	}
+	for _, frame := range frames {
+		if ack, ok := frame.(*logging.AckFrame); ok && ack.LargestAcked() >= c.firstPacketOnPath {
+			c.acknowledgedAt = now
+			return
+		}
+	}
+}
+
+// reader counts the bytes read towards the byte trigger
+func (m *migrator) reader(r io.Reader) io.Reader {
+	if m.afterBytes <= 0 {
+		return r
+	}
+	return &migratingReader{reader: r, migrator: m}
+}
+
+type migratingReader struct {
+	reader   io.Reader
+	migrator *migrator
+}
+
+func (r *migratingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if r.migrator.receivedBytes.Add(int64(n)) >= r.migrator.afterBytes && r.migrator.triggered.CompareAndSwap(false, true) {
+		go r.migrator.migrate()
+	}
+	return n, err
+}
+
+// migrate moves all open connections to new UDP sockets, only the first call has an effect,
+// and none after stop
+func (m *migrator) migrate() {
+	m.once.Do(func() {
+		m.mutex.Lock()
+		open := make([]*migratedConnection, 0)
+		for _, id := range m.ids {
+			c := m.connections[id]
+			if c.conn != nil && c.conn.Context().Err() == nil {
+				open = append(open, c)
+			}
+		}
+		m.mutex.Unlock()
+		if len(open) == 0 {
+			log.Warnf("no open QUIC connection to migrate")
+			return
+		}
+		for _, c := range open {
+			go m.migrateConnection(c)
+		}
+	})
+}
+
+func (m *migrator) migrateConnection(c *migratedConnection) {
+	odcid := c.conn.OriginalDestinationConnectionID()
+	// waits until the handshake is confirmed, then closes the old UDP socket and opens the new one
+	addr, err := c.conn.MigrateUDPSocket()
+	if err != nil {
+		log.Errorf("failed to migrate QUIC connection %s: %v", odcid, err)
+		return
+	}
+	// packets sent from now on use the new socket
+	m.mutex.Lock()
+	c.migratedAt = time.Now()
+	m.mutex.Unlock()
+	m.metrics.Migrated()
+	log.WithFields(log.Fields{"odcid": odcid.String(), "local": addr.String()}).Infof("migrated QUIC connection %s to local address %s", odcid, addr)
+}
+
+// report logs the migration latency and the throughput before and after the migration of every migrated connection
+func (m *migrator) report() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, id := range m.ids {
+		c := m.connections[id]
+		if c.migratedAt.IsZero() {
+			continue
+		}
+		before := c.throughput(c.migratedAt.Add(-migrationThroughputWindow), c.migratedAt)
+		after := c.throughput(c.migratedAt, c.migratedAt.Add(migrationThroughputWindow))
+		if c.acknowledgedAt.IsZero() {
+			log.WithFields(log.Fields{"odcid": id, "throughput_before": before}).Infof("migration of QUIC connection %s: no packet acknowledged on the new path, throughput before: %.3f Mbit/s", id, before)
+			continue
+		}
+		latency := c.acknowledgedAt.Sub(c.migratedAt).Seconds()
+		log.WithFields(log.Fields{"odcid": id, "latency": latency, "throughput_before": before, "throughput_after": after}).Infof("migration of QUIC connection %s: latency: %f s, throughput before: %.3f Mbit/s, after: %.3f Mbit/s (%s window)", id, latency, before, after, migrationThroughputWindow)
+	}
+}
+
+// throughput returns the received Mbit/s between from and to
+func (c *migratedConnection) throughput(from time.Time, to time.Time) float64 {
+	var bytes int64
+	for bin := from.UnixNano() / int64(migrationThroughputBin); bin < to.UnixNano()/int64(migrationThroughputBin); bin++ {
+		bytes += c.bins[bin]
+	}
+	return float64(bytes*8) / to.Sub(from).Seconds() / 1e6
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/logging"
+	"testing"
+	"time"
+)
+
+func TestMigrationTracer(t *testing.T) {
+	m := newMigrator(0, 1, nil)
+	odcid := quic.ConnectionIDFromBytes([]byte{1, 2, 3, 4})
+	tracer := m.tracer().TracerForConnection(context.Background(), logging.PerspectiveClient, odcid)
+	c := m.connections[odcid.String()]
+	ack := func(largest logging.PacketNumber) []logging.Frame {
+		return []logging.Frame{&logging.AckFrame{AckRanges: []logging.AckRange{{Smallest: 0, Largest: largest}}}}
+	}
+	sent := func(pn logging.PacketNumber, long bool) {
+		tracer.SentPacket(&logging.ExtendedHeader{Header: logging.Header{IsLongHeader: long}, PacketNumber: pn}, 50, nil, nil)
+	}
+
+	sent(1, false)
+	tracer.ReceivedShortHeaderPacket(&logging.ShortHeader{}, 1000, ack(1))
+	if c.firstPacketOnPath != noPacketNumber || !c.acknowledgedAt.IsZero() {
+		t.Errorf("expected no packet on the new path before the migration")
+	}
+
+	c.migratedAt = time.Now()
+	sent(2, true)
+	sent(10, false)
+	sent(11, false)
+	if c.firstPacketOnPath != 10 {
+		t.Errorf("expected packet 10 as first packet on the new path, got %d", c.firstPacketOnPath)
+	}
+	// acknowledges packets sent on the old path
+	tracer.ReceivedShortHeaderPacket(&logging.ShortHeader{}, 1000, ack(9))
+	if !c.acknowledgedAt.IsZero() {
+		t.Errorf("expected no acknowledgment of the new path")
+	}
+	tracer.ReceivedShortHeaderPacket(&logging.ShortHeader{}, 1000, ack(11))
+	if c.acknowledgedAt.IsZero() {
+		t.Errorf("expected acknowledgment of the new path")
+	}
+	var received int64
+	for _, bytes := range c.bins {
+		received += bytes
+	}
+	if received != 3000 {
+		t.Errorf("expected 3000 received bytes, got %d", received)
+	}
+}
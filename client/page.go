@@ -0,0 +1,44 @@
+package client
+
+import (
+	u "net/url"
+	"sync/atomic"
+	"time"
+)
+
+// page groups a document and its requisites to measure the page load time
+type page struct {
+	url u.URL
+	// number of links followed from an initial url
+	depth    int
+	start    time.Time
+	pending  atomic.Int64
+	done     chan struct{}
+	requests atomic.Int64
+	bytes    atomic.Int64
+}
+
+func newPage(url u.URL, depth int) *page {
+	return &page{
+		url:   url,
+		depth: depth,
+		done:  make(chan struct{}),
+	}
+}
+
+func (p *page) addPending() {
+	p.pending.Add(1)
+}
+
+// finishPending returns true if this was the last pending request of the page
+func (p *page) finishPending() bool {
+	if p.pending.Add(-1) == 0 {
+		close(p.done)
+		return true
+	}
+	return false
+}
+
+func (p *page) loadTime() time.Duration {
+	return time.Now().Sub(p.start)
+}
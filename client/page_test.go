@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"http-perf-go/internal"
+	"http-perf-go/server"
+	"net"
+	u "net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startServer serves the files on an ephemeral port of the loopback interface until the test ends.
+// returns the url of index.html and the certificate file to trust
+func startServer(t *testing.T, files map[string]string) (*u.URL, string) {
+	dir := t.TempDir()
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	cert, err := internal.GenerateCertificate(internal.CertificateConfig{
+		CommonName: "localhost",
+		IPs:        []net.IP{net.IPv4(127, 0, 0, 1)},
+		Validity:   time.Hour,
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = cert.WriteFiles(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	listening := make(chan *net.UDPAddr, 1)
+	sErr := make(chan error, 1)
+	go func() {
+		sErr <- server.RunContext(ctx, server.Config{
+			Addr:        "127.0.0.1:0",
+			ServeDir:    dir,
+			TlsCertFile: certFile,
+			TlsKeyFile:  keyFile,
+			OnListen: func(addr *net.UDPAddr) {
+				listening <- addr
+			},
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-sErr
+	})
+	select {
+	case addr := <-listening:
+		return &u.URL{Scheme: "https", Host: addr.String(), Path: "/index.html"}, certFile
+	case err := <-sErr:
+		t.Fatalf("failed to start server: %v", err)
+		return nil, ""
+	}
+}
+
+func TestRecursive(t *testing.T) {
+	link := func(targets ...string) string {
+		html := "<html><body>"
+		for _, target := range targets {
+			html += fmt.Sprintf(`<a href="%s">%s</a>`, target, target)
+		}
+		return html + "</body></html>"
+	}
+	url, certFile := startServer(t, map[string]string{
+		// a.html is linked twice and index.html links back to itself
+		"index.html": link("a.html", "b.html", "a.html", "c.html", "index.html"),
+		"a.html":     link("deep.html"),
+		"b.html":     link(),
+		"c.html":     link(),
+		"deep.html":  link(),
+	})
+	cases := []struct {
+		maxPages     int
+		maxLinkDepth int
+		requests     int64
+	}{
+		// index, a, b, c; deep.html is too deep
+		{10, 1, 4},
+		{10, 2, 5},
+		{2, 1, 2},
+		{1, 1, 1},
+		{10, 0, 1},
+	}
+	for _, tc := range cases {
+		summary, err := RunWithSummary(Config{
+			Urls:               []*u.URL{url},
+			TLSCertFile:        certFile,
+			ParallelRequests:   4,
+			MaxDepth:           -1,
+			Recursive:          true,
+			MaxPages:           tc.maxPages,
+			MaxLinkDepth:       tc.maxLinkDepth,
+			SegmentConnections: 1,
+			ConnectionsPerHost: 1,
+			RunTimeout:         10 * time.Second,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if summary.Requests != tc.requests || summary.Failures != 0 {
+			t.Errorf("expected %d requests without failures for %d pages and link depth %d, got %d requests and %d failures", tc.requests, tc.maxPages, tc.maxLinkDepth, summary.Requests, summary.Failures)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package client
+
+import (
+	u "net/url"
+	"regexp"
+	"testing"
+)
+
+func TestIsUrlAllowed(t *testing.T) {
+	cases := []struct {
+		allowlist []string
+		url       string
+		expected  bool
+	}{
+		{nil, "https://example.com/a.png", true},
+		{[]string{`\.png$`}, "https://example.com/a.png", true},
+		{[]string{`\.png$`}, "https://example.com/a.css", false},
+		{[]string{`\.png$`, `\.css$`}, "https://example.com/a.css", true},
+		{[]string{`^https://cdn\.`}, "https://example.com/a.png", false},
+	}
+	for _, tc := range cases {
+		allowlist := make([]*regexp.Regexp, 0)
+		for _, expr := range tc.allowlist {
+			allowlist = append(allowlist, regexp.MustCompile(expr))
+		}
+		c := &client{config: &Config{UrlAllowlist: allowlist}}
+		url, _ := u.Parse(tc.url)
+		if allowed := c.isUrlAllowed(*url); allowed != tc.expected {
+			t.Errorf("expected %t for %s with allowlist %v, got %t", tc.expected, tc.url, tc.allowlist, allowed)
+		}
+	}
+}
+
+func TestIsHostInScope(t *testing.T) {
+	cases := []struct {
+		spanHosts bool
+		domains   []string
+		host      string
+		expected  bool
+	}{
+		{false, nil, "example.com", true},
+		{false, nil, "cdn.example.com", false},
+		{true, nil, "cdn.other.com", true},
+		{true, []string{"example.com"}, "example.com", true},
+		{true, []string{"example.com"}, "cdn.example.com", true},
+		{true, []string{"example.com"}, "badexample.com", false},
+		{true, []string{"other.com"}, "example.com", false},
+		{false, []string{"other.com"}, "example.com", true},
+		{false, []string{"other.com"}, "img.other.com", true},
+		{false, []string{"other.com"}, "third.com", false},
+	}
+	for _, tc := range cases {
+		c := &client{
+			config:       &Config{SpanHosts: tc.spanHosts, Domains: tc.domains},
+			initialHosts: map[string]bool{"example.com": true},
+		}
+		if inScope := c.isHostInScope(tc.host); inScope != tc.expected {
+			t.Errorf("expected %t for %s with span hosts %t and domains %v, got %t", tc.expected, tc.host, tc.spanHosts, tc.domains, inScope)
+		}
+	}
+}
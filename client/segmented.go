@@ -0,0 +1,239 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"http-perf-go/internal"
+	"io"
+	"net/http"
+	u "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// byteRange is an inclusive range of bytes, like in the Range header
+type byteRange struct {
+	first int64
+	last  int64
+}
+
+func (r byteRange) length() int64 {
+	return r.last - r.first + 1
+}
+
+// splitRanges splits size bytes into at most n contiguous ranges of nearly equal length
+func splitRanges(size int64, n int) []byteRange {
+	if int64(n) > size {
+		n = int(size)
+	}
+	ranges := make([]byteRange, 0, n)
+	var first int64
+	for i := 0; i < n; i++ {
+		length := size / int64(n)
+		if int64(i) < size%int64(n) {
+			length++
+		}
+		ranges = append(ranges, byteRange{first: first, last: first + length - 1})
+		first += length
+	}
+	return ranges
+}
+
+// parseContentRange parses the Content-Range header, e.g. "bytes 0-99/1000"
+func parseContentRange(contentRange string) (byteRange, int64, error) {
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return byteRange{}, 0, fmt.Errorf("invalid content range: %q", contentRange)
+	}
+	spec := strings.TrimPrefix(contentRange, "bytes ")
+	rangeSpec, sizeSpec, found := strings.Cut(spec, "/")
+	if !found {
+		return byteRange{}, 0, fmt.Errorf("invalid content range: %q", contentRange)
+	}
+	firstSpec, lastSpec, found := strings.Cut(rangeSpec, "-")
+	if !found {
+		return byteRange{}, 0, fmt.Errorf("invalid content range: %q", contentRange)
+	}
+	first, err := strconv.ParseInt(firstSpec, 10, 64)
+	if err != nil {
+		return byteRange{}, 0, fmt.Errorf("invalid content range: %q", contentRange)
+	}
+	last, err := strconv.ParseInt(lastSpec, 10, 64)
+	if err != nil {
+		return byteRange{}, 0, fmt.Errorf("invalid content range: %q", contentRange)
+	}
+	size, err := strconv.ParseInt(sizeSpec, 10, 64)
+	if err != nil {
+		return byteRange{}, 0, fmt.Errorf("invalid content range: %q", contentRange)
+	}
+	return byteRange{first: first, last: last}, size, nil
+}
+
+// downloadSegmented downloads the url in Segments parallel range requests,
+// distributed round-robin over the segment clients.
+// Falls back to a single request if the server does not support byte ranges.
+// return received bytes
+func (c *client) downloadSegmented(ctx context.Context, url *u.URL, onFindRequisite func(*u.URL), onFindLink func(*u.URL)) (int64, error) {
+	if c.config.RequestTimeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.RequestTimeout)
+		defer cancel()
+	}
+	log.Infof("HEAD %s", url)
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("user-agent", c.config.UserAgent)
+	rsp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK || rsp.Header.Get("Accept-Ranges") != "bytes" || rsp.ContentLength <= 0 {
+		log.Warnf("server does not support byte ranges for %s, download in a single request", url)
+		return c.download(ctx, url, onFindRequisite, onFindLink)
+	}
+	size := rsp.ContentLength
+	contentType := strings.ToLower(strings.Split(rsp.Header.Get("Content-Type"), ";")[0])
+	// the segments must belong to the same representation
+	validator := rsp.Header.Get("ETag")
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = rsp.Header.Get("Last-Modified")
+	}
+
+	var body []byte
+	if c.needsBody(contentType, onFindLink != nil) {
+		body = make([]byte, size)
+	}
+	ranges := splitRanges(size, c.config.Segments)
+	var received int64
+	var receivedMutex sync.Mutex
+	errs := make(chan error, len(ranges))
+	// the other segments are canceled when a segment fails
+	segmentCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for i, r := range ranges {
+		i, r := i, r
+		httpClient := c.segmentClients[i%len(c.segmentClients)]
+		go func() {
+			n, err := c.downloadSegment(segmentCtx, httpClient, url, r, size, validator, body)
+			receivedMutex.Lock()
+			received += n
+			receivedMutex.Unlock()
+			if err != nil {
+				err = fmt.Errorf("segment %d (bytes %d-%d): %w", i, r.first, r.last, err)
+			}
+			errs <- err
+		}()
+	}
+	var segmentErr error
+	for range ranges {
+		if err := <-errs; err != nil && segmentErr == nil {
+			segmentErr = err
+			cancel()
+		}
+	}
+	stop := time.Now()
+	c.totalDecodedBytes.Add(received)
+	c.metrics.decodedBytes.Add(float64(received))
+	if segmentErr != nil {
+		return received, segmentErr
+	}
+	if received != size {
+		return received, fmt.Errorf("received %d byte, expected %d byte", received, size)
+	}
+	connections := len(c.segmentClients)
+	if len(ranges) < connections {
+		connections = len(ranges)
+	}
+	fields := responseFields(url, rsp, received, stop.Sub(start))
+	fields["segments"] = len(ranges)
+	fields["connections"] = connections
+	log.WithFields(fields).Infof("got %s %s %d, %d byte in %d segments over %d connections, %f s", url, rsp.Proto, rsp.StatusCode, received, len(ranges), connections, stop.Sub(start).Seconds())
+
+	if body != nil {
+		body, err = decodeToUtf8(body, rsp.Header.Get("Content-Type"), contentType)
+		if err != nil {
+			return received, fmt.Errorf("failed to decode %s: %w", contentType, err)
+		}
+	}
+	return received, c.findRequisites(url, contentType, rsp.Header, body, onFindRequisite, onFindLink)
+}
+
+// downloadSegment requests the byte range and copies it to its position in body, if body is not nil.
+// return received bytes
+func (c *client) downloadSegment(ctx context.Context, httpClient *http.Client, url *u.URL, r byteRange, size int64, validator string, body []byte) (int64, error) {
+	c.totalGetRequests.Add(1)
+	c.metrics.requests.Inc()
+	log.WithFields(log.Fields{"url": url.String(), "range": fmt.Sprintf("%d-%d", r.first, r.last)}).Infof("GET %s bytes %d-%d", url, r.first, r.last)
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("user-agent", c.config.UserAgent)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", r.first, r.last))
+	if validator != "" {
+		req.Header.Set("If-Range", validator)
+	}
+	rsp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+	c.connectionRequests.add(rsp)
+	var reader io.Reader = rsp.Body
+	if c.migrator != nil {
+		c.migrator.track(rsp)
+		reader = c.migrator.reader(reader)
+	}
+	if rsp.StatusCode != http.StatusPartialContent {
+		if isHttpStatusError(rsp.StatusCode) {
+			c.metrics.failure(c.failures.addStatus(rsp.StatusCode))
+		}
+		// a full response means the resource changed since the HEAD request
+		return 0, fmt.Errorf("unexpected status %d", rsp.StatusCode)
+	}
+	contentRange, contentSize, err := parseContentRange(rsp.Header.Get("Content-Range"))
+	if err != nil {
+		return 0, err
+	}
+	if contentRange != r || contentSize != size {
+		return 0, fmt.Errorf("unexpected content range %q", rsp.Header.Get("Content-Range"))
+	}
+	var w io.Writer = internal.DiscardWriter{}
+	if body != nil {
+		w = &sliceWriter{buf: body[r.first : r.last+1]}
+	}
+	received, err := io.Copy(w, io.LimitReader(reader, r.length()+1))
+	if err != nil {
+		return received, err
+	}
+	if received != r.length() {
+		return received, fmt.Errorf("received %d byte, expected %d byte", received, r.length())
+	}
+	stop := time.Now()
+	c.metrics.requestDuration.Observe(stop.Sub(start).Seconds())
+	fields := responseFields(url, rsp, received, stop.Sub(start))
+	fields["range"] = fmt.Sprintf("%d-%d", r.first, r.last)
+	log.WithFields(fields).Infof("got %s bytes %d-%d %s %d, %f s, %s", url, r.first, r.last, rsp.Proto, rsp.StatusCode, stop.Sub(start).Seconds(), requestLocation(rsp))
+	return received, nil
+}
+
+// sliceWriter writes to a fixed size buffer
+type sliceWriter struct {
+	buf []byte
+	n   int
+}
+
+func (s *sliceWriter) Write(p []byte) (int, error) {
+	if len(p) > len(s.buf)-s.n {
+		return 0, io.ErrShortWrite
+	}
+	s.n += copy(s.buf[s.n:], p)
+	return len(p), nil
+}
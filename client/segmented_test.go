@@ -0,0 +1,31 @@
+package client
+
+import "testing"
+
+func TestSplitRanges(t *testing.T) {
+	ranges := splitRanges(10, 3)
+	expected := []byteRange{{0, 3}, {4, 6}, {7, 9}}
+	if len(ranges) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, ranges)
+	}
+	for i := range expected {
+		if ranges[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, ranges)
+		}
+	}
+	if ranges := splitRanges(2, 4); len(ranges) != 2 {
+		t.Errorf("expected at most one range per byte, got %v", ranges)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	r, size, err := parseContentRange("bytes 100-199/1000")
+	if err != nil || r != (byteRange{100, 199}) || size != 1000 {
+		t.Errorf("unexpected result %v %d %v", r, size, err)
+	}
+	for _, invalid := range []string{"", "bytes */1000", "bytes 0-99/*", "items 0-99/1000"} {
+		if _, _, err := parseContentRange(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
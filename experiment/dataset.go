@@ -0,0 +1,221 @@
+package experiment
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"http-perf-go/client"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Result of a single run
+type Result struct {
+	RunID         string `json:"run_id"`
+	Configuration int    `json:"configuration"`
+	Repetition    int    `json:"repetition"`
+	Parameters
+	// nil if the run failed before the first request
+	Summary *client.Summary `json:"-"`
+	Error   string          `json:"error,omitempty"`
+	// copied from Summary, for the JSON dataset
+	DurationSeconds float64 `json:"duration_s"`
+	ReceivedBytes   int64   `json:"received_bytes"`
+	DecodedBytes    int64   `json:"decoded_bytes"`
+	Requests        int64   `json:"requests"`
+	Retries         int64   `json:"retries"`
+	Failures        int64   `json:"failures"`
+	QuicConnections int64   `json:"quic_connections"`
+	CacheHits       int64   `json:"cache_hits"`
+	NotModified     int64   `json:"not_modified"`
+	// e.g. "reno", to group the runs by congestion controller
+	CongestionControl string `json:"congestion_control"`
+}
+
+func newResult(runID string, configuration int, repetition int, parameters Parameters, summary *client.Summary, err error) Result {
+	r := Result{
+		RunID:         runID,
+		Configuration: configuration,
+		Repetition:    repetition,
+		Parameters:    parameters,
+		Summary:       summary,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if summary != nil {
+		r.DurationSeconds = summary.Duration.Seconds()
+		r.ReceivedBytes = summary.ReceivedBytes
+		r.DecodedBytes = summary.DecodedBytes
+		r.Requests = summary.Requests
+		r.Retries = summary.Retries
+		r.Failures = summary.Failures
+		r.QuicConnections = summary.QuicConnections
+		r.CacheHits = summary.CacheHits
+		r.NotModified = summary.NotModified
+	}
+	return r
+}
+
+// successful runs finished without error and without failed requests
+func (r *Result) successful() bool {
+	return r.Error == "" && r.Summary != nil && r.Summary.Failures == 0
+}
+
+// Aggregate statistics of the successful runs of a configuration
+type Aggregate struct {
+	Configuration int `json:"configuration"`
+	Parameters
+	Runs           int `json:"runs"`
+	SuccessfulRuns int `json:"successful_runs"`
+	// sample standard deviation, 0 for less than two runs
+	DurationMean      float64 `json:"duration_mean_s"`
+	DurationStddev    float64 `json:"duration_stddev_s"`
+	DurationMin       float64 `json:"duration_min_s"`
+	DurationMax       float64 `json:"duration_max_s"`
+	ReceivedBytesMean float64 `json:"received_bytes_mean"`
+}
+
+// aggregate the results, in the order of the configurations
+func aggregate(matrix []Parameters, results []Result) []Aggregate {
+	aggregates := make([]Aggregate, len(matrix))
+	durations := make([][]float64, len(matrix))
+	receivedBytes := make([]int64, len(matrix))
+	for i, p := range matrix {
+		aggregates[i] = Aggregate{Configuration: i + 1, Parameters: p}
+	}
+	for _, r := range results {
+		i := r.Configuration - 1
+		aggregates[i].Runs++
+		if !r.successful() {
+			continue
+		}
+		aggregates[i].SuccessfulRuns++
+		durations[i] = append(durations[i], r.DurationSeconds)
+		receivedBytes[i] += r.ReceivedBytes
+	}
+	for i := range aggregates {
+		a := &aggregates[i]
+		if a.SuccessfulRuns == 0 {
+			continue
+		}
+		a.DurationMin = math.Inf(1)
+		var sum float64
+		for _, d := range durations[i] {
+			sum += d
+			a.DurationMin = math.Min(a.DurationMin, d)
+			a.DurationMax = math.Max(a.DurationMax, d)
+		}
+		a.DurationMean = sum / float64(a.SuccessfulRuns)
+		if a.SuccessfulRuns > 1 {
+			var squares float64
+			for _, d := range durations[i] {
+				squares += (d - a.DurationMean) * (d - a.DurationMean)
+			}
+			a.DurationStddev = math.Sqrt(squares / float64(a.SuccessfulRuns-1))
+		}
+		a.ReceivedBytesMean = float64(receivedBytes[i]) / float64(a.SuccessfulRuns)
+	}
+	return aggregates
+}
+
+// writeDataset writes a JSON file if the filename ends with .json.
+// otherwise the runs are written to a CSV file and the aggregates to <name>_aggregates.csv
+func writeDataset(filename string, results []Result, aggregates []Aggregate) error {
+	if strings.HasSuffix(filename, ".json") {
+		return writeJSON(filename, results, aggregates)
+	}
+	runs := make([][]string, 0, len(results)+1)
+	runs = append(runs, []string{"run_id", "configuration", "repetition", "parallel", "xse", "proxy", "early_handover", "page_requisites", "duration_s", "received_bytes", "decoded_bytes", "requests", "retries", "failures", "quic_connections", "cache_hits", "not_modified", "congestion_control", "error"})
+	for _, r := range results {
+		runs = append(runs, append(append([]string{
+			r.RunID,
+			strconv.Itoa(r.Configuration),
+			strconv.Itoa(r.Repetition),
+		}, parameterRecord(r.Parameters)...),
+			formatFloat(r.DurationSeconds),
+			strconv.FormatInt(r.ReceivedBytes, 10),
+			strconv.FormatInt(r.DecodedBytes, 10),
+			strconv.FormatInt(r.Requests, 10),
+			strconv.FormatInt(r.Retries, 10),
+			strconv.FormatInt(r.Failures, 10),
+			strconv.FormatInt(r.QuicConnections, 10),
+			strconv.FormatInt(r.CacheHits, 10),
+			strconv.FormatInt(r.NotModified, 10),
+			r.CongestionControl,
+			r.Error,
+		))
+	}
+	err := writeCSVFile(filename, runs)
+	if err != nil {
+		return err
+	}
+
+	records := make([][]string, 0, len(aggregates)+1)
+	records = append(records, []string{"configuration", "parallel", "xse", "proxy", "early_handover", "page_requisites", "runs", "successful_runs", "duration_mean_s", "duration_stddev_s", "duration_min_s", "duration_max_s", "received_bytes_mean"})
+	for _, a := range aggregates {
+		records = append(records, append(append([]string{
+			strconv.Itoa(a.Configuration),
+		}, parameterRecord(a.Parameters)...),
+			strconv.Itoa(a.Runs),
+			strconv.Itoa(a.SuccessfulRuns),
+			formatFloat(a.DurationMean),
+			formatFloat(a.DurationStddev),
+			formatFloat(a.DurationMin),
+			formatFloat(a.DurationMax),
+			formatFloat(a.ReceivedBytesMean),
+		))
+	}
+	return writeCSVFile(strings.TrimSuffix(filename, filepath.Ext(filename))+"_aggregates.csv", records)
+}
+
+func parameterRecord(p Parameters) []string {
+	return []string{
+		strconv.Itoa(p.Parallel),
+		strconv.FormatBool(p.XSE),
+		p.Proxy,
+		strconv.FormatBool(p.EarlyHandover),
+		strconv.FormatBool(p.PageRequisites),
+	}
+}
+
+func writeJSON(filename string, results []Result, aggregates []Aggregate) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(struct {
+		Runs           []Result    `json:"runs"`
+		Configurations []Aggregate `json:"configurations"`
+	}{results, aggregates})
+	if err != nil {
+		return err
+	}
+	log.Infof("created json file: %s", filename)
+	return f.Close()
+}
+
+func writeCSVFile(filename string, records [][]string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	err = w.WriteAll(records)
+	if err != nil {
+		return err
+	}
+	log.Infof("created csv file: %s", filename)
+	return f.Close()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,102 @@
+package experiment
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"http-perf-go/client"
+	"http-perf-go/internal"
+	"io"
+	u "net/url"
+	"path/filepath"
+)
+
+type Config struct {
+	Spec *Spec
+	// template of every run; the urls and the parameters of the spec are overwritten.
+	// if qlog files are written to a directory, the files of a run are written to <dir>/<experiment run id>/<run id>
+	Client client.Config
+	// certificate file to trust the proxies; if empty, only the system certificates are trusted
+	TLSProxyCertFile string
+	// may be nil
+	KeyLogWriter io.Writer
+	// CSV or JSON file of the dataset; if empty, only the aggregates are printed
+	Output string
+}
+
+// Run runs every configuration of the matrix the number of repetitions, one after another.
+// Failed runs are recorded and do not stop the experiment
+func Run(config Config) error {
+	var urls []*u.URL
+	for _, urlStr := range config.Spec.Urls {
+		url, err := u.ParseRequestURI(urlStr)
+		if err != nil {
+			return fmt.Errorf("invalid url %s: %v", urlStr, err)
+		}
+		urls = append(urls, url)
+	}
+	matrix := config.Spec.Matrix(Parameters{
+		Parallel:       config.Client.ParallelRequests,
+		XSE:            config.Client.ExtraStreamEncryption,
+		EarlyHandover:  config.Client.AllowEarlyHandover,
+		PageRequisites: config.Client.PageRequisites,
+	})
+	log.Infof("running %d configurations, %d repetitions each", len(matrix), config.Spec.Repetitions)
+
+	results := make([]Result, 0, len(matrix)*config.Spec.Repetitions)
+	for i, parameters := range matrix {
+		for repetition := 1; repetition <= config.Spec.Repetitions; repetition++ {
+			runID := fmt.Sprintf("c%d-r%d", i+1, repetition)
+			log.WithFields(log.Fields{
+				"run_id":        runID,
+				"configuration": i + 1,
+				"repetition":    repetition,
+			}).Infof("start run %s, %s", runID, parameters)
+			summary, err := run(&config, urls, runID, parameters)
+			if err != nil {
+				log.WithField("run_id", runID).Warnf("run %s failed: %v", runID, err)
+			}
+			result := newResult(runID, i+1, repetition, parameters, summary, err)
+			// also known if the run failed before the first request
+			result.CongestionControl = config.Client.CongestionControl.String()
+			results = append(results, result)
+		}
+	}
+
+	aggregates := aggregate(matrix, results)
+	for _, a := range aggregates {
+		log.WithFields(log.Fields{
+			"configuration":     a.Configuration,
+			"runs":              a.Runs,
+			"successful_runs":   a.SuccessfulRuns,
+			"duration_mean_s":   a.DurationMean,
+			"duration_stddev_s": a.DurationStddev,
+		}).Infof("configuration %d (%s): %d/%d successful runs, duration mean: %.3f s, stddev: %.3f s, min: %.3f s, max: %.3f s", a.Configuration, a.Parameters, a.SuccessfulRuns, a.Runs, a.DurationMean, a.DurationStddev, a.DurationMin, a.DurationMax)
+	}
+	if config.Output == "" {
+		return nil
+	}
+	return writeDataset(config.Output, results, aggregates)
+}
+
+func run(config *Config, urls []*u.URL, runID string, parameters Parameters) (*client.Summary, error) {
+	clientConfig := config.Client
+	clientConfig.Urls = urls
+	clientConfig.ParallelRequests = parameters.Parallel
+	clientConfig.ExtraStreamEncryption = parameters.XSE
+	clientConfig.AllowEarlyHandover = parameters.EarlyHandover
+	clientConfig.PageRequisites = parameters.PageRequisites
+	clientConfig.ProxyConfig = nil
+	if parameters.Proxy != "" {
+		// a new proxy config per run, so no session ticket or token is reused
+		proxyConf, err := internal.NewProxyConfig(parameters.Proxy, config.TLSProxyCertFile, config.KeyLogWriter)
+		if err != nil {
+			return nil, err
+		}
+		clientConfig.ProxyConfig = proxyConf
+	}
+	if clientConfig.QlogConfig.Dir != "" {
+		clientConfig.QlogConfig.Dir = filepath.Join(clientConfig.QlogConfig.Dir, clientConfig.QlogConfig.RunID)
+		clientConfig.QlogConfig.RunID = runID
+	}
+	return client.RunWithSummary(clientConfig)
+}
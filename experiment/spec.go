@@ -0,0 +1,113 @@
+package experiment
+
+import (
+	"bytes"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+)
+
+// Spec describes the parameter matrix of an experiment.
+// JSON specs are parsed as YAML, which is a superset of JSON.
+// Empty parameter lists use the value of the client configuration template
+type Spec struct {
+	Urls []string `yaml:"urls"`
+	// number of runs of every configuration, default 1
+	Repetitions    int      `yaml:"repetitions"`
+	Parallel       []int    `yaml:"parallel"`
+	XSE            []bool   `yaml:"xse"`
+	Proxy          []string `yaml:"proxy"`
+	EarlyHandover  []bool   `yaml:"early_handover"`
+	PageRequisites []bool   `yaml:"page_requisites"`
+}
+
+// Parameters of a single configuration of the matrix.
+// an empty Proxy means no proxy
+type Parameters struct {
+	Parallel       int    `json:"parallel"`
+	XSE            bool   `json:"xse"`
+	Proxy          string `json:"proxy"`
+	EarlyHandover  bool   `json:"early_handover"`
+	PageRequisites bool   `json:"page_requisites"`
+}
+
+func ReadSpec(filename string) (*Spec, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := ParseSpec(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid experiment spec %s: %w", filename, err)
+	}
+	return spec, nil
+}
+
+// ParseSpec parses a YAML or JSON spec, unknown fields are rejected
+func ParseSpec(data []byte) (*Spec, error) {
+	spec := &Spec{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err := decoder.Decode(spec)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(spec.Urls) == 0 {
+		return nil, fmt.Errorf("no urls specified")
+	}
+	if spec.Repetitions < 0 {
+		return nil, fmt.Errorf("negative repetitions")
+	}
+	if spec.Repetitions == 0 {
+		spec.Repetitions = 1
+	}
+	for _, parallel := range spec.Parallel {
+		if parallel <= 0 {
+			return nil, fmt.Errorf("parallel must be positive")
+		}
+	}
+	return spec, nil
+}
+
+// Matrix returns the cartesian product of all parameter lists,
+// in the order parallel, xse, proxy, early_handover, page_requisites;
+// the last parameter changes fastest
+func (s *Spec) Matrix(defaults Parameters) []Parameters {
+	matrix := []Parameters{defaults}
+	if len(s.Parallel) > 0 {
+		matrix = expand(matrix, s.Parallel, func(p *Parameters, v int) { p.Parallel = v })
+	}
+	if len(s.XSE) > 0 {
+		matrix = expand(matrix, s.XSE, func(p *Parameters, v bool) { p.XSE = v })
+	}
+	if len(s.Proxy) > 0 {
+		matrix = expand(matrix, s.Proxy, func(p *Parameters, v string) { p.Proxy = v })
+	}
+	if len(s.EarlyHandover) > 0 {
+		matrix = expand(matrix, s.EarlyHandover, func(p *Parameters, v bool) { p.EarlyHandover = v })
+	}
+	if len(s.PageRequisites) > 0 {
+		matrix = expand(matrix, s.PageRequisites, func(p *Parameters, v bool) { p.PageRequisites = v })
+	}
+	return matrix
+}
+
+func expand[T any](matrix []Parameters, values []T, set func(*Parameters, T)) []Parameters {
+	expanded := make([]Parameters, 0, len(matrix)*len(values))
+	for _, p := range matrix {
+		for _, v := range values {
+			set(&p, v)
+			expanded = append(expanded, p)
+		}
+	}
+	return expanded
+}
+
+func (p Parameters) String() string {
+	proxy := p.Proxy
+	if proxy == "" {
+		proxy = "none"
+	}
+	return fmt.Sprintf("parallel: %d, xse: %t, proxy: %s, early handover: %t, page requisites: %t", p.Parallel, p.XSE, proxy, p.EarlyHandover, p.PageRequisites)
+}
@@ -0,0 +1,92 @@
+package experiment
+
+import (
+	"errors"
+	"http-perf-go/client"
+	"testing"
+	"time"
+)
+
+func TestParseSpec(t *testing.T) {
+	yamlSpec := `
+urls: [https://localhost:8080/]
+repetitions: 3
+parallel: [1, 6]
+xse: [false, true]
+proxy: ["", "localhost:18081"]
+`
+	jsonSpec := `{"urls": ["https://localhost:8080/"], "repetitions": 3, "parallel": [1, 6], "xse": [false, true], "proxy": ["", "localhost:18081"]}`
+	for _, data := range []string{yamlSpec, jsonSpec} {
+		spec, err := ParseSpec([]byte(data))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if spec.Repetitions != 3 || len(spec.Parallel) != 2 || len(spec.XSE) != 2 || len(spec.Proxy) != 2 {
+			t.Errorf("unexpected spec: %+v", spec)
+		}
+	}
+	_, err := ParseSpec([]byte("urls: [https://localhost:8080/]\nparalel: [1]"))
+	if err == nil {
+		t.Errorf("expected error for unknown field")
+	}
+	_, err = ParseSpec([]byte("parallel: [1]"))
+	if err == nil {
+		t.Errorf("expected error for missing urls")
+	}
+	spec, err := ParseSpec([]byte("urls: [https://localhost:8080/]"))
+	if err != nil || spec.Repetitions != 1 {
+		t.Errorf("expected 1 repetition by default")
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	spec := &Spec{
+		Parallel: []int{1, 6},
+		XSE:      []bool{false, true},
+		Proxy:    []string{"", "localhost:18081"},
+	}
+	matrix := spec.Matrix(Parameters{Parallel: 10, PageRequisites: true})
+	if len(matrix) != 8 {
+		t.Fatalf("expected 8 configurations, got %d", len(matrix))
+	}
+	first, last := matrix[0], matrix[7]
+	if first != (Parameters{Parallel: 1, PageRequisites: true}) {
+		t.Errorf("unexpected first configuration: %s", first)
+	}
+	if last != (Parameters{Parallel: 6, XSE: true, Proxy: "localhost:18081", PageRequisites: true}) {
+		t.Errorf("unexpected last configuration: %s", last)
+	}
+	if matrix[1].Proxy != "localhost:18081" || matrix[1].XSE {
+		t.Errorf("the last parameter must change fastest: %s", matrix[1])
+	}
+	if len((&Spec{}).Matrix(Parameters{Parallel: 10})) != 1 {
+		t.Errorf("expected a single configuration without parameter lists")
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	matrix := []Parameters{{Parallel: 1}, {Parallel: 6}}
+	summary := func(d time.Duration) *client.Summary {
+		return &client.Summary{Duration: d, ReceivedBytes: 100}
+	}
+	results := []Result{
+		newResult("c1-r1", 1, 1, matrix[0], summary(1*time.Second), nil),
+		newResult("c1-r2", 1, 2, matrix[0], summary(3*time.Second), nil),
+		newResult("c1-r3", 1, 3, matrix[0], nil, errors.New("failed")),
+		newResult("c2-r1", 2, 1, matrix[1], summary(2*time.Second), nil),
+	}
+	aggregates := aggregate(matrix, results)
+	a := aggregates[0]
+	if a.Runs != 3 || a.SuccessfulRuns != 2 {
+		t.Errorf("expected 2 of 3 successful runs, got %d of %d", a.SuccessfulRuns, a.Runs)
+	}
+	if a.DurationMean != 2 || a.DurationMin != 1 || a.DurationMax != 3 || a.ReceivedBytesMean != 100 {
+		t.Errorf("unexpected aggregate: %+v", a)
+	}
+	if a.DurationStddev < 1.414 || a.DurationStddev > 1.415 {
+		t.Errorf("expected sample stddev of 1.414, got %f", a.DurationStddev)
+	}
+	if aggregates[1].DurationStddev != 0 || aggregates[1].DurationMean != 2 {
+		t.Errorf("unexpected aggregate: %+v", aggregates[1])
+	}
+}
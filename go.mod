@@ -8,16 +8,21 @@ replace (
 )
 
 require (
+	github.com/PuerkitoBio/goquery v1.8.0
+	github.com/andybalholm/brotli v1.0.4
 	github.com/birneee/webpage-requisites-go v0.0.0-20221116193224-258025144a4a
+	github.com/klauspost/compress v1.15.15
 	github.com/lucas-clemente/quic-go v0.30.0
 	github.com/marten-seemann/qtls-go1-19 v0.1.1
 	github.com/sirupsen/logrus v1.9.0
 	github.com/urfave/cli/v2 v2.3.0
 	golang.org/x/exp v0.0.0-20221114191408-850992195362
+	golang.org/x/net v0.1.0
+	golang.org/x/text v0.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/PuerkitoBio/goquery v1.8.0 // indirect
 	github.com/andybalholm/cascadia v1.3.1 // indirect
 	github.com/cpuguy83/go-md2man/v2 v2.0.0-20190314233015-f79a8a8ca69d // indirect
 	github.com/francoispqt/gojay v1.2.13 // indirect
@@ -31,8 +36,6 @@ require (
 	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
 	golang.org/x/crypto v0.1.0 // indirect
 	golang.org/x/mod v0.6.0 // indirect
-	golang.org/x/net v0.1.0 // indirect
 	golang.org/x/sys v0.1.1-0.20221102194838-fc697a31fa06 // indirect
-	golang.org/x/text v0.4.0 // indirect
 	golang.org/x/tools v0.2.0 // indirect
 )
@@ -0,0 +1,39 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var byteCountUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	// longer suffixes first, so that "KiB" is not matched as "B"
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"B", 1},
+}
+
+// ParseByteCount parses byte counts like "1500", "100KB" or "1MiB"
+func ParseByteCount(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	multiplier := int64(1)
+	for _, unit := range byteCountUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	count, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("invalid byte count: %s", s)
+	}
+	return count * multiplier, nil
+}
@@ -0,0 +1,27 @@
+package internal
+
+import "testing"
+
+func TestParseByteCount(t *testing.T) {
+	cases := map[string]int64{
+		"1500":  1500,
+		"100B":  100,
+		"100KB": 100000,
+		"10 MB": 10000000,
+		"1KiB":  1024,
+		"2MiB":  2 << 20,
+		"1GB":   1000000000,
+		"0":     0,
+	}
+	for s, expected := range cases {
+		count, err := ParseByteCount(s)
+		if err != nil || count != expected {
+			t.Errorf("expected %d for %q, got %d %v", expected, s, count, err)
+		}
+	}
+	for _, invalid := range []string{"", "MB", "-1", "1.5MB", "2s"} {
+		if _, err := ParseByteCount(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
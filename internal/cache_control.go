@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// CacheControlPolicy sets the Cache-Control header of responses for matching paths
+type CacheControlPolicy struct {
+	// pattern in the syntax of path.Match.
+	// patterns without "/" are matched against the file name only
+	Pattern string
+	Value   string
+}
+
+// ParseCacheControlPolicy parses policies in the form "pattern=value", e.g. "*.css=max-age=3600"
+func ParseCacheControlPolicy(policy string) (CacheControlPolicy, error) {
+	pattern, value, found := strings.Cut(policy, "=")
+	if !found || pattern == "" {
+		return CacheControlPolicy{}, fmt.Errorf("invalid cache control policy %q, expected pattern=value", policy)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return CacheControlPolicy{}, fmt.Errorf("invalid cache control pattern %q: %w", pattern, err)
+	}
+	return CacheControlPolicy{
+		Pattern: pattern,
+		Value:   value,
+	}, nil
+}
+
+// matchCacheControl returns the value of the first policy matching the url path
+func matchCacheControl(policies []CacheControlPolicy, urlPath string) (string, bool) {
+	for _, policy := range policies {
+		subject := urlPath
+		if !strings.Contains(policy.Pattern, "/") {
+			subject = path.Base(urlPath)
+		}
+		if matched, _ := path.Match(policy.Pattern, subject); matched {
+			return policy.Value, true
+		}
+	}
+	return "", false
+}
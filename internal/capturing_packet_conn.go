@@ -0,0 +1,76 @@
+package internal
+
+import (
+	log "github.com/sirupsen/logrus"
+	"net"
+	"sync"
+	"time"
+)
+
+// capturingPacketConn writes every sent and received datagram to a pcapng file
+type capturingPacketConn struct {
+	net.PacketConn
+	pcap      *PcapWriter
+	localAddr *net.UDPAddr
+	// log only the first write error
+	errOnce sync.Once
+}
+
+// NewCapturingPacketConn wraps a UDP socket.
+// Features of *net.UDPConn like ECN are not available to quic-go through the wrapper.
+func NewCapturingPacketConn(conn net.PacketConn, pcap *PcapWriter) net.PacketConn {
+	localAddr, _ := conn.LocalAddr().(*net.UDPAddr)
+	if localAddr == nil {
+		localAddr = &net.UDPAddr{}
+	}
+	return &capturingPacketConn{
+		PacketConn: conn,
+		pcap:       pcap,
+		localAddr:  localAddr,
+	}
+}
+
+func (c *capturingPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if err == nil {
+		if udpAddr, ok := addr.(*net.UDPAddr); ok {
+			c.capture(udpAddr, c.localAddr, p[:n])
+		}
+	}
+	return n, addr, err
+}
+
+func (c *capturingPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(p, addr)
+	if err == nil {
+		if udpAddr, ok := addr.(*net.UDPAddr); ok {
+			c.capture(c.localAddr, udpAddr, p[:n])
+		}
+	}
+	return n, err
+}
+
+func (c *capturingPacketConn) capture(src *net.UDPAddr, dst *net.UDPAddr, payload []byte) {
+	err := c.pcap.WritePacket(time.Now(), src, dst, payload)
+	if err != nil {
+		c.errOnce.Do(func() {
+			log.Errorf("failed to write packet capture: %v", err)
+		})
+	}
+}
+
+// SetReadBuffer passes through to the UDP socket, so quic-go can increase the receive buffer
+func (c *capturingPacketConn) SetReadBuffer(bytes int) error {
+	if conn, ok := c.PacketConn.(interface{ SetReadBuffer(int) error }); ok {
+		return conn.SetReadBuffer(bytes)
+	}
+	return nil
+}
+
+// SetWriteBuffer passes through to the UDP socket, so quic-go can increase the send buffer
+func (c *capturingPacketConn) SetWriteBuffer(bytes int) error {
+	if conn, ok := c.PacketConn.(interface{ SetWriteBuffer(int) error }); ok {
+		return conn.SetWriteBuffer(bytes)
+	}
+	return nil
+}
@@ -6,11 +6,16 @@ import (
 	"io/ioutil"
 )
 
+// SystemCertPoolWithAdditionalCert returns the system cert pool, with the certificates of the file.
+// If tlsCertFile is empty, only the system certificates are trusted
 func SystemCertPoolWithAdditionalCert(tlsCertFile string) (*x509.CertPool, error) {
 	certPool, err := x509.SystemCertPool()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get system cert pool: %v", err)
 	}
+	if tlsCertFile == "" {
+		return certPool, nil
+	}
 
 	caCertRaw, err := ioutil.ReadFile(tlsCertFile)
 	if err != nil {
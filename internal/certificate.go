@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+type CertificateConfig struct {
+	CommonName string
+	// subject alternative names
+	Hostnames []string
+	IPs       []net.IP
+	Validity  time.Duration
+	// the certificate can sign other certificates
+	IsCA bool
+}
+
+// Certificate with ECDSA P-256 key
+type Certificate struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// GenerateCertificate signs the certificate with the key of parent.
+// The validity ends with the validity of parent at the latest, later certificates are rejected by clients.
+// If parent is nil, the certificate is self-signed and can be trusted directly
+func GenerateCertificate(config CertificateConfig, parent *Certificate) (*Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: config.CommonName, Organization: []string{"http-perf-go"}},
+		NotBefore:             now.Add(-time.Hour), // tolerate clock skew
+		NotAfter:              now.Add(config.Validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              config.Hostnames,
+		IPAddresses:           config.IPs,
+	}
+	if parent != nil && template.NotAfter.After(parent.Cert.NotAfter) {
+		template.NotAfter = parent.Cert.NotAfter
+	}
+	if config.IsCA || parent == nil {
+		template.IsCA = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	}
+	signerCert, signerKey := template, crypto.Signer(key)
+	if parent != nil {
+		signerCert, signerKey = parent.Cert, parent.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, key.Public(), signerKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Certificate{Cert: cert, Key: key}, nil
+}
+
+// WriteFiles writes the PEM encoded certificate and key.
+// The key file is only readable by the owner
+func (c *Certificate) WriteFiles(certFile string, keyFile string) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(c.Key)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Cert.Raw}), 0644)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600)
+}
+
+// LoadCertificate reads a PEM encoded certificate and key, e.g. of a CA to sign other certificates
+func LoadCertificate(certFile string, keyFile string) (*Certificate, error) {
+	tlsCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(tlsCert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	key, ok := tlsCert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", tlsCert.PrivateKey)
+	}
+	return &Certificate{Cert: cert, Key: key}, nil
+}
+
+// TLSCertificate returns the certificate for a tls.Config
+func (c *Certificate) TLSCertificate() tls.Certificate {
+	return tls.Certificate{
+		Certificate: [][]byte{c.Cert.Raw},
+		PrivateKey:  c.Key,
+		Leaf:        c.Cert,
+	}
+}
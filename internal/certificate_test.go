@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"crypto/x509"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGenerateCertificate(t *testing.T) {
+	ca, err := GenerateCertificate(CertificateConfig{CommonName: "ca", Validity: time.Hour, IsCA: true}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	leaf, err := GenerateCertificate(CertificateConfig{
+		CommonName: "localhost",
+		Hostnames:  []string{"localhost", "example.com"},
+		IPs:        []net.IP{net.IPv4(127, 0, 0, 1)},
+		Validity:   time.Hour,
+	}, ca)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if leaf.Cert.IsCA {
+		t.Errorf("leaf must not be a CA")
+	}
+
+	dir := t.TempDir()
+	err = ca.WriteFiles(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	loaded, err := LoadCertificate(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(loaded.Cert)
+	for _, name := range []string{"localhost", "example.com", "127.0.0.1"} {
+		_, err = leaf.Cert.Verify(x509.VerifyOptions{DNSName: name, Roots: roots})
+		if err != nil {
+			t.Errorf("failed to verify %s: %v", name, err)
+		}
+	}
+	_, err = leaf.Cert.Verify(x509.VerifyOptions{DNSName: "other.com", Roots: roots})
+	if err == nil {
+		t.Errorf("expected error for hostname not in the certificate")
+	}
+
+	selfSigned, err := GenerateCertificate(CertificateConfig{Hostnames: []string{"localhost"}, Validity: time.Hour}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	roots = x509.NewCertPool()
+	roots.AddCert(selfSigned.Cert)
+	_, err = selfSigned.Cert.Verify(x509.VerifyOptions{DNSName: "localhost", Roots: roots})
+	if err != nil {
+		t.Errorf("failed to verify self-signed certificate: %v", err)
+	}
+}
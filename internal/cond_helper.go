@@ -1,12 +1,17 @@
 package internal
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
 type CondHelper[T any] interface {
 	SetState(T)
 	UpdateState(func(T) T)
 	// Wait until the condition is true
 	Wait(cond func(T) bool)
+	// WaitContext waits until the condition is true or the context is done
+	WaitContext(ctx context.Context, cond func(T) bool) error
 }
 
 type condHelper[T any] struct {
@@ -30,7 +35,10 @@ func (c *condHelper[T]) SetState(state T) {
 }
 
 func (c *condHelper[T]) UpdateState(update func(T) T) {
-	c.SetState(update(c.state))
+	c.cond.L.Lock()
+	c.state = update(c.state)
+	c.cond.Broadcast()
+	c.cond.L.Unlock()
 }
 
 func (c *condHelper[T]) Wait(condition func(T) bool) {
@@ -40,3 +48,27 @@ func (c *condHelper[T]) Wait(condition func(T) bool) {
 	}
 	c.cond.L.Unlock()
 }
+
+func (c *condHelper[T]) WaitContext(ctx context.Context, condition func(T) bool) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// the lock is only available while the waiter waits, so the broadcast is not missed
+			c.cond.L.Lock()
+			c.cond.Broadcast()
+			c.cond.L.Unlock()
+		case <-stop:
+		}
+	}()
+	c.cond.L.Lock()
+	defer c.cond.L.Unlock()
+	for !condition(c.state) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		c.cond.Wait()
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCondHelperWaitContext(t *testing.T) {
+	c := NewCondHelper(0)
+	go func() {
+		for i := 0; i < 3; i++ {
+			c.UpdateState(func(s int) int { return s + 1 })
+		}
+	}()
+	err := c.WaitContext(context.Background(), func(s int) bool { return s == 3 })
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = c.WaitContext(ctx, func(s int) bool { return s == 4 })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/lucas-clemente/quic-go"
+	"net"
+)
+
+// NewReno, the default of the quic-go fork
+const CONGESTION_CONTROL_RENO = "reno"
+const CONGESTION_CONTROL_HYBLA_WESTWOOD = "hybla-westwood"
+
+// CONGESTION_CONTROL_FIXED_WINDOW keeps the congestion window constant, as a baseline.
+// This is not a fixed rate, the sending rate is window/RTT and varies with the RTT
+const CONGESTION_CONTROL_FIXED_WINDOW = "fixed-window"
+
+// CONGESTION_CONTROL_FIXED_RATE paces the packets of every connection at a constant rate, as a baseline.
+// The congestion window is fixed to the maximum of quic-go, so only the rate and flow control limit the sender.
+// The pacing is applied to the UDP socket, so the connections can not be migrated
+const CONGESTION_CONTROL_FIXED_RATE = "fixed-rate"
+
+// CongestionControl selects a congestion controller supported by the quic-go fork
+type CongestionControl struct {
+	Algorithm string
+	// congestion window of the fixed-window algorithm, in packets
+	FixedWindow uint32
+	// sending rate of the fixed-rate algorithm, in Mbit/s
+	FixedRate float64
+}
+
+// ParseCongestionControl returns an error if the algorithm is not supported.
+// If fixedWindow is 0, the default initial congestion window of quic-go is used.
+// fixedRate is required by the fixed-rate algorithm
+func ParseCongestionControl(algorithm string, fixedWindow uint32, fixedRate float64) (CongestionControl, error) {
+	switch algorithm {
+	case CONGESTION_CONTROL_RENO, CONGESTION_CONTROL_HYBLA_WESTWOOD:
+		return CongestionControl{Algorithm: algorithm}, nil
+	case CONGESTION_CONTROL_FIXED_WINDOW:
+		if fixedWindow == 0 {
+			fixedWindow = quic.DefaultInitialCongestionWindow
+		}
+		return CongestionControl{Algorithm: algorithm, FixedWindow: fixedWindow}, nil
+	case CONGESTION_CONTROL_FIXED_RATE:
+		if fixedRate <= 0 {
+			return CongestionControl{}, fmt.Errorf("%s congestion control requires a positive rate", algorithm)
+		}
+		return CongestionControl{Algorithm: algorithm, FixedRate: fixedRate}, nil
+	default:
+		return CongestionControl{}, fmt.Errorf("unsupported congestion control: %s, supported are %s, %s, %s and %s", algorithm, CONGESTION_CONTROL_RENO, CONGESTION_CONTROL_HYBLA_WESTWOOD, CONGESTION_CONTROL_FIXED_WINDOW, CONGESTION_CONTROL_FIXED_RATE)
+	}
+}
+
+// Apply sets the congestion controller in the QUIC config
+func (c CongestionControl) Apply(conf *quic.Config) {
+	switch c.Algorithm {
+	case CONGESTION_CONTROL_HYBLA_WESTWOOD:
+		conf.HyblaWestwoodCongestionControl = true
+	case CONGESTION_CONTROL_FIXED_WINDOW:
+		conf.InitialCongestionWindow = c.FixedWindow
+		conf.MinCongestionWindow = c.FixedWindow
+		conf.MaxCongestionWindow = c.FixedWindow
+	case CONGESTION_CONTROL_FIXED_RATE:
+		conf.InitialCongestionWindow = quic.DefaultMaxCongestionWindow
+		conf.MinCongestionWindow = quic.DefaultMaxCongestionWindow
+		conf.MaxCongestionWindow = quic.DefaultMaxCongestionWindow
+	}
+}
+
+// Paced returns true if the UDP sockets must be wrapped by WrapPacketConn
+func (c CongestionControl) Paced() bool {
+	return c.Algorithm == CONGESTION_CONTROL_FIXED_RATE
+}
+
+// WrapPacketConn paces the datagrams to every remote address at the fixed rate.
+// The socket is returned unchanged, if the algorithm is not fixed-rate
+func (c CongestionControl) WrapPacketConn(conn net.PacketConn) net.PacketConn {
+	if !c.Paced() {
+		return conn
+	}
+	return NewPacingPacketConn(conn, c.FixedRate*1e6/8)
+}
+
+// String returns the algorithm, e.g. "reno", "fixed-window (32 packets)" or "fixed-rate (10 Mbit/s)"
+func (c CongestionControl) String() string {
+	if c.Algorithm == "" {
+		return CONGESTION_CONTROL_RENO
+	}
+	if c.Algorithm == CONGESTION_CONTROL_FIXED_WINDOW {
+		return fmt.Sprintf("%s (%d packets)", c.Algorithm, c.FixedWindow)
+	}
+	if c.Algorithm == CONGESTION_CONTROL_FIXED_RATE {
+		return fmt.Sprintf("%s (%g Mbit/s)", c.Algorithm, c.FixedRate)
+	}
+	return c.Algorithm
+}
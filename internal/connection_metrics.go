@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"github.com/lucas-clemente/quic-go/logging"
+	"sync"
+	"time"
+)
+
+// ConnectionMetrics counts the QUIC connection events of client and server.
+// All methods may be called on nil, then they have no effect.
+type ConnectionMetrics struct {
+	started           *Counter
+	closed            *Counter
+	migrations        *Counter
+	handshakeDuration *Histogram
+	mutex             sync.Mutex
+	// start of connections with unconfirmed handshake
+	startedAt map[string]time.Time
+}
+
+// NewConnectionMetrics returns nil if registry is nil.
+// prefix is prepended to the metric names, e.g. http_perf_client
+func NewConnectionMetrics(registry MetricsRegistry, prefix string) *ConnectionMetrics {
+	if registry == nil {
+		return nil
+	}
+	return &ConnectionMetrics{
+		started:           registry.Counter(prefix+"_connections_started", "QUIC connections started"),
+		closed:            registry.Counter(prefix+"_connections_closed", "QUIC connections closed"),
+		migrations:        registry.Counter(prefix+"_migrations", "QUIC connection migrations"),
+		handshakeDuration: registry.Histogram(prefix+"_handshake_duration_seconds", "duration from the start of a QUIC connection until the handshake is confirmed", DefaultDurationBuckets),
+		startedAt:         make(map[string]time.Time),
+	}
+}
+
+func (m *ConnectionMetrics) StartedConnection(odcid logging.ConnectionID) {
+	if m == nil {
+		return
+	}
+	m.started.Inc()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.startedAt[odcid.String()] = time.Now()
+}
+
+func (m *ConnectionMetrics) HandshakeConfirmed(odcid logging.ConnectionID) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	startedAt, ok := m.startedAt[odcid.String()]
+	delete(m.startedAt, odcid.String())
+	m.mutex.Unlock()
+	if ok {
+		m.handshakeDuration.Observe(time.Since(startedAt).Seconds())
+	}
+}
+
+func (m *ConnectionMetrics) ClosedConnection(odcid logging.ConnectionID) {
+	if m == nil {
+		return
+	}
+	m.closed.Inc()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.startedAt, odcid.String())
+}
+
+func (m *ConnectionMetrics) Migrated() {
+	if m == nil {
+		return
+	}
+	m.migrations.Inc()
+}
@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const CONTENT_ENCODING_IDENTITY = "identity"
+const CONTENT_ENCODING_GZIP = "gzip"
+const CONTENT_ENCODING_BROTLI = "br"
+const CONTENT_ENCODING_ZSTD = "zstd"
+
+// ContentEncodingFileExtensions maps content encodings to the file extensions of precompressed files
+var ContentEncodingFileExtensions = map[string]string{
+	CONTENT_ENCODING_GZIP:   ".gz",
+	CONTENT_ENCODING_BROTLI: ".br",
+	CONTENT_ENCODING_ZSTD:   ".zst",
+}
+
+// NewContentDecoder returns a reader that decodes the content encoding.
+func NewContentDecoder(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(encoding) {
+	case "", CONTENT_ENCODING_IDENTITY:
+		return io.NopCloser(r), nil
+	case CONTENT_ENCODING_GZIP:
+		return gzip.NewReader(r)
+	case CONTENT_ENCODING_BROTLI:
+		return io.NopCloser(brotli.NewReader(r)), nil
+	case CONTENT_ENCODING_ZSTD:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+}
+
+// NewContentEncoder returns a writer that encodes the content encoding.
+// The writer must be closed to flush the encoded content.
+func NewContentEncoder(encoding string, w io.Writer) (io.WriteCloser, error) {
+	switch strings.ToLower(encoding) {
+	case CONTENT_ENCODING_GZIP:
+		return gzip.NewWriter(w), nil
+	case CONTENT_ENCODING_BROTLI:
+		return brotli.NewWriter(w), nil
+	case CONTENT_ENCODING_ZSTD:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+}
+
+// NegotiateContentEncoding selects an offered content encoding by the Accept-Encoding request header.
+// The encoding with the highest quality value is selected,
+// ties are resolved by the order of the offered encodings.
+// returns an empty string if only the identity encoding is acceptable.
+func NegotiateContentEncoding(acceptEncoding string, offered []string) string {
+	qualities := map[string]float64{}
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(entry, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		quality := 1.0
+		params = strings.TrimSpace(params)
+		if strings.HasPrefix(params, "q=") {
+			parsed, err := strconv.ParseFloat(params[2:], 64)
+			if err == nil {
+				quality = parsed
+			}
+		}
+		qualities[name] = quality
+	}
+	var selected string
+	var selectedQuality float64
+	for _, encoding := range offered {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > selectedQuality {
+			selected = encoding
+			selectedQuality = quality
+		}
+	}
+	return selected
+}
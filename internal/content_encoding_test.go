@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestNegotiateContentEncoding(t *testing.T) {
+	offered := []string{CONTENT_ENCODING_BROTLI, CONTENT_ENCODING_ZSTD, CONTENT_ENCODING_GZIP}
+	cases := map[string]string{
+		"":                     "",
+		"identity":             "",
+		"gzip":                 CONTENT_ENCODING_GZIP,
+		"gzip, br, zstd":       CONTENT_ENCODING_BROTLI,
+		"gzip, br;q=0.5":       CONTENT_ENCODING_GZIP,
+		"br;q=0, *":            CONTENT_ENCODING_ZSTD,
+		"deflate, GZIP;q=0.8 ": CONTENT_ENCODING_GZIP,
+	}
+	for acceptEncoding, expected := range cases {
+		if actual := NegotiateContentEncoding(acceptEncoding, offered); actual != expected {
+			t.Errorf("expected %q for %q, got %q", expected, acceptEncoding, actual)
+		}
+	}
+}
+
+func TestContentEncodingRoundTrip(t *testing.T) {
+	content := bytes.Repeat([]byte("http-perf-go "), 100)
+	for _, encoding := range []string{CONTENT_ENCODING_GZIP, CONTENT_ENCODING_BROTLI, CONTENT_ENCODING_ZSTD} {
+		var encoded bytes.Buffer
+		encoder, err := NewContentEncoder(encoding, &encoded)
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+		_, _ = encoder.Write(content)
+		_ = encoder.Close()
+		decoder, err := NewContentDecoder(encoding, &encoded)
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+		decoded, err := io.ReadAll(decoder)
+		if err != nil {
+			t.Errorf("%v", err)
+		}
+		if !bytes.Equal(content, decoded) {
+			t.Errorf("%s round trip failed", encoding)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package internal
+
+import "io"
+
+// CountingReader counts the bytes read from the inner reader
+type CountingReader struct {
+	Reader io.Reader
+	Count  int64
+}
+
+func (c *CountingReader) Read(p []byte) (n int, err error) {
+	n, err = c.Reader.Read(p)
+	c.Count += int64(n)
+	return n, err
+}
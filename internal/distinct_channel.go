@@ -1,37 +1,49 @@
 package internal
 
 import (
+	"context"
 	"sync"
 )
 
-type DistinctChannel[T comparable] interface {
+type DistinctChannel[T any] interface {
 	// Add returns true if element was added
 	// false when element is not distinct
 	Add(elem T) bool
 	Next() T
+	// NextContext blocks until the next element is available or the context is done
+	NextContext(ctx context.Context) (T, error)
 }
 
-type distinctChannel[T comparable] struct {
+type distinctChannel[T any, K comparable] struct {
 	internal     chan T
+	key          func(T) K
 	historyMutex sync.Mutex
-	history      map[T]bool /* use as set; value is always true */
+	history      map[K]bool /* use as set; value is always true */
 }
 
 // NewDistinctChannel provides a channel with only unique elements
 func NewDistinctChannel[T comparable](size int) DistinctChannel[T] {
+	return NewDistinctChannelFunc(size, func(elem T) T { return elem })
+}
+
+// NewDistinctChannelFunc provides a channel with only elements of unique keys.
+// The key of an element is derived by the key function.
+func NewDistinctChannelFunc[T any, K comparable](size int, key func(T) K) DistinctChannel[T] {
 
-	c := &distinctChannel[T]{
+	c := &distinctChannel[T, K]{
 		internal: make(chan T, size),
-		history:  make(map[T]bool),
+		key:      key,
+		history:  make(map[K]bool),
 	}
 
 	return c
 }
 
-func (c *distinctChannel[T]) Add(elem T) bool {
+func (c *distinctChannel[T, K]) Add(elem T) bool {
+	key := c.key(elem)
 	c.historyMutex.Lock()
-	_, found := c.history[elem]
-	c.history[elem] = true
+	_, found := c.history[key]
+	c.history[key] = true
 	c.historyMutex.Unlock()
 	if found {
 		return false // element is not unique
@@ -40,7 +52,17 @@ func (c *distinctChannel[T]) Add(elem T) bool {
 	return true
 }
 
-func (c *distinctChannel[T]) Next() T {
+func (c *distinctChannel[T, K]) Next() T {
 	elem := <-c.internal
 	return elem
 }
+
+func (c *distinctChannel[T, K]) NextContext(ctx context.Context) (T, error) {
+	select {
+	case elem := <-c.internal:
+		return elem, nil
+	case <-ctx.Done():
+		var empty T
+		return empty, ctx.Err()
+	}
+}
@@ -21,3 +21,26 @@ func TestDistinct(t *testing.T) {
 		t.Errorf("second insert must never be distinct")
 	}
 }
+
+func TestDistinctFunc(t *testing.T) {
+	type item struct {
+		url   u.URL
+		depth int
+	}
+	dc := NewDistinctChannelFunc(10, func(i item) u.URL { return i.url })
+	url, err := u.Parse("https://example.com")
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	distinct := dc.Add(item{*url, 0})
+	if !distinct {
+		t.Errorf("first insert must always be distinct")
+	}
+	distinct = dc.Add(item{*url, 1})
+	if distinct {
+		t.Errorf("insert with same key must never be distinct")
+	}
+	if dc.Next().depth != 0 {
+		t.Errorf("first inserted element must be returned")
+	}
+}
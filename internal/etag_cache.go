@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// etagCache stores strong ETags derived from the file content.
+// ETags are recomputed when the modification time or size of a file changes.
+type etagCache struct {
+	mutex   sync.Mutex
+	entries map[string]etagEntry
+}
+
+type etagEntry struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+func newEtagCache() *etagCache {
+	return &etagCache{
+		entries: make(map[string]etagEntry),
+	}
+}
+
+func (c *etagCache) get(root http.FileSystem, name string) (string, error) {
+	file, err := root.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if stat.IsDir() {
+		return "", errors.New("is a directory")
+	}
+
+	c.mutex.Lock()
+	entry, ok := c.entries[name]
+	c.mutex.Unlock()
+	if ok && entry.modTime.Equal(stat.ModTime()) && entry.size == stat.Size() {
+		return entry.etag, nil
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	c.mutex.Lock()
+	c.entries[name] = etagEntry{
+		modTime: stat.ModTime(),
+		size:    stat.Size(),
+		etag:    etag,
+	}
+	c.mutex.Unlock()
+	return etag, nil
+}
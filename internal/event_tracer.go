@@ -15,6 +15,11 @@ type Handlers struct {
 	StartedConnection func(odcid logging.ConnectionID, local, remote net.Addr, srcConnID, destConnID logging.ConnectionID)
 	UpdatePath        func(odcid logging.ConnectionID, newRemote net.Addr)
 	ClosedConnection  func(odcid logging.ConnectionID, err error)
+	// called for every sent packet
+	SentPacket     func(odcid logging.ConnectionID, size logging.ByteCount)
+	UpdatedMetrics func(odcid logging.ConnectionID, rttStats *logging.RTTStats, cwnd, bytesInFlight logging.ByteCount, packetsInFlight int)
+	// called when the handshake keys are dropped
+	HandshakeConfirmed func(odcid logging.ConnectionID)
 }
 
 func NewEventTracer(handlers Handlers) logging.Tracer {
@@ -53,3 +58,21 @@ func (c connectionEventTracer) ClosedConnection(err error) {
 		c.handers.ClosedConnection(c.odcid, err)
 	}
 }
+
+func (c connectionEventTracer) SentPacket(hdr *logging.ExtendedHeader, size logging.ByteCount, ack *logging.AckFrame, frames []logging.Frame) {
+	if c.handers.SentPacket != nil {
+		c.handers.SentPacket(c.odcid, size)
+	}
+}
+
+func (c connectionEventTracer) UpdatedMetrics(rttStats *logging.RTTStats, cwnd, bytesInFlight logging.ByteCount, packetsInFlight int) {
+	if c.handers.UpdatedMetrics != nil {
+		c.handers.UpdatedMetrics(c.odcid, rttStats, cwnd, bytesInFlight, packetsInFlight)
+	}
+}
+
+func (c connectionEventTracer) DroppedEncryptionLevel(level logging.EncryptionLevel) {
+	if level == logging.EncryptionHandshake && c.handers.HandshakeConfirmed != nil {
+		c.handers.HandshakeConfirmed(c.odcid)
+	}
+}
@@ -1,18 +1,33 @@
 package internal
 
 import (
+	"io"
+	"mime"
 	"net/http"
 	"net/url"
+	"path"
+	"path/filepath"
 	"strings"
 )
 
 type fileServer struct {
+	root   http.FileSystem
 	inner  http.Handler
 	config FileServerConfig
+	etags  *etagCache
 }
 
 type FileServerConfig struct {
 	QueryStringAsPartOfFile bool
+	// content encodings to compress responses on the fly, in order of preference.
+	// if empty, responses are not compressed on the fly
+	Compression []string
+	// serve precompressed files, e.g. index.html.gz or index.html.br, if accepted by the client
+	Precompressed bool
+	// Cache-Control headers of the first matching path pattern are set
+	CacheControl []CacheControlPolicy
+	// set strong ETags derived from the file content
+	ETags bool
 }
 
 // FileServer is http.Server with some additional options
@@ -22,8 +37,10 @@ type FileServer interface {
 
 func NewFileServer(root http.FileSystem, config FileServerConfig) FileServer {
 	return &fileServer{
+		root:   root,
 		inner:  http.FileServer(root),
 		config: config,
+		etags:  newEtagCache(),
 	}
 }
 
@@ -36,5 +53,197 @@ func (f fileServer) ServeHTTP(writer http.ResponseWriter, request *http.Request)
 			panic(err)
 		}
 	}
+	if cacheControl, ok := matchCacheControl(f.config.CacheControl, request.URL.Path); ok {
+		writer.Header().Set("Cache-Control", cacheControl)
+	}
+	if f.config.Precompressed || len(f.config.Compression) != 0 {
+		writer.Header().Add("Vary", "Accept-Encoding")
+	}
+	if f.config.Precompressed && f.servePrecompressed(writer, request) {
+		return
+	}
+	if f.config.ETags {
+		f.setEtag(writer, request)
+	}
+	if len(f.config.Compression) != 0 && request.Method != http.MethodHead {
+		encoding := NegotiateContentEncoding(request.Header.Get("Accept-Encoding"), f.config.Compression)
+		if encoding != "" {
+			// the content type of a 304 response is unknown, so it is derived from the file extension
+			compressible := isCompressible(mime.TypeByExtension(path.Ext(requestedFile(request))))
+			if compressible {
+				// byte ranges of content compressed on the fly are not supported.
+				// ranges of other files are served uncompressed, e.g. for segmented downloads
+				request.Header.Del("Range")
+				// validators of the compressed representation are derived from the uncompressed one
+				if ifNoneMatch := request.Header.Get("If-None-Match"); ifNoneMatch != "" {
+					ifNoneMatch = stripEtagSuffix(ifNoneMatch, "-"+encoding)
+					if ifNoneMatch == "" {
+						request.Header.Del("If-None-Match")
+					} else {
+						request.Header.Set("If-None-Match", ifNoneMatch)
+					}
+				}
+			}
+			cw := &compressingResponseWriter{ResponseWriter: writer, encoding: encoding, compressible: compressible}
+			defer cw.Close()
+			writer = cw
+		}
+	}
 	f.inner.ServeHTTP(writer, request)
 }
+
+// requestedFile returns the path of the requested file, index.html for directories
+func requestedFile(request *http.Request) string {
+	name := path.Clean("/" + request.URL.Path)
+	if strings.HasSuffix(request.URL.Path, "/") {
+		name = path.Join(name, "index.html")
+	}
+	return name
+}
+
+// stripEtagSuffix removes the suffix from the entity tags of an If-None-Match header.
+// Tags without the suffix are removed, because they match a different representation.
+// Returns an empty string if no tag is left
+func stripEtagSuffix(ifNoneMatch string, suffix string) string {
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			tags = append(tags, tag)
+		} else if strings.HasSuffix(tag, suffix+`"`) {
+			tags = append(tags, strings.TrimSuffix(tag, suffix+`"`)+`"`)
+		}
+	}
+	return strings.Join(tags, ", ")
+}
+
+// setEtag sets the ETag of the requested file, if it exists
+func (f fileServer) setEtag(writer http.ResponseWriter, request *http.Request) {
+	etag, err := f.etags.get(f.root, requestedFile(request))
+	if err != nil {
+		return // the inner handler responds with the error
+	}
+	writer.Header().Set("ETag", etag)
+}
+
+// servePrecompressed returns false if there is no acceptable precompressed file
+func (f fileServer) servePrecompressed(writer http.ResponseWriter, request *http.Request) bool {
+	name := path.Clean("/" + request.URL.Path)
+	if strings.HasSuffix(request.URL.Path, "/") {
+		return false // directory index
+	}
+	offered := []string{CONTENT_ENCODING_BROTLI, CONTENT_ENCODING_ZSTD, CONTENT_ENCODING_GZIP}
+	for {
+		encoding := NegotiateContentEncoding(request.Header.Get("Accept-Encoding"), offered)
+		if encoding == "" {
+			return false
+		}
+		file, err := f.root.Open(name + ContentEncodingFileExtensions[encoding])
+		if err != nil {
+			offered = removeString(offered, encoding)
+			continue
+		}
+		defer file.Close()
+		stat, err := file.Stat()
+		if err != nil || stat.IsDir() {
+			offered = removeString(offered, encoding)
+			continue
+		}
+		contentType := mime.TypeByExtension(filepath.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		writer.Header().Set("Content-Type", contentType)
+		writer.Header().Set("Content-Encoding", encoding)
+		if f.config.ETags {
+			etag, err := f.etags.get(f.root, name+ContentEncodingFileExtensions[encoding])
+			if err == nil {
+				writer.Header().Set("ETag", etag)
+			}
+		}
+		http.ServeContent(writer, request, name, stat.ModTime(), file)
+		return true
+	}
+}
+
+func removeString(s []string, elem string) []string {
+	filtered := make([]string, 0, len(s))
+	for _, e := range s {
+		if e != elem {
+			filtered = append(filtered, e)
+		}
+	}
+	return filtered
+}
+
+// compressingResponseWriter compresses successful responses of compressible content types
+type compressingResponseWriter struct {
+	http.ResponseWriter
+	encoding string
+	// the content type derived from the file extension is compressible
+	compressible bool
+	encoder      io.WriteCloser
+	wroteHeader  bool
+}
+
+func (c *compressingResponseWriter) WriteHeader(statusCode int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+	header := c.ResponseWriter.Header()
+	if statusCode == http.StatusOK && header.Get("Content-Encoding") == "" && isCompressible(header.Get("Content-Type")) {
+		encoder, err := NewContentEncoder(c.encoding, c.ResponseWriter)
+		if err == nil {
+			c.encoder = encoder
+			header.Set("Content-Encoding", c.encoding)
+			header.Del("Content-Length")
+			c.setEtagSuffix()
+		}
+	}
+	if statusCode == http.StatusNotModified && c.compressible {
+		c.setEtagSuffix()
+	}
+	c.ResponseWriter.WriteHeader(statusCode)
+}
+
+// setEtagSuffix distinguishes the ETag of the compressed representation, e.g. "abc-gzip"
+func (c *compressingResponseWriter) setEtagSuffix() {
+	header := c.ResponseWriter.Header()
+	if etag := header.Get("ETag"); strings.HasSuffix(etag, `"`) {
+		header.Set("ETag", strings.TrimSuffix(etag, `"`)+"-"+c.encoding+`"`)
+	}
+}
+
+func (c *compressingResponseWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.encoder != nil {
+		return c.encoder.Write(p)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+func (c *compressingResponseWriter) Close() error {
+	if c.encoder != nil {
+		return c.encoder.Close()
+	}
+	return nil
+}
+
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case MIME_TYPE_APPLICATION_JAVASCRIPT, MIME_TYPE_APPLICATION_MANIFEST_JSON, "application/json", "application/xml", "image/svg+xml":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestFileServer(t *testing.T, config FileServerConfig) FileServer {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("0123456789"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "a.bin"), []byte("0123456789"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewFileServer(http.Dir(dir), config)
+}
+
+func serve(handler http.Handler, header http.Header) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodGet, "/a.txt", nil)
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestFileServerRange(t *testing.T) {
+	fileServer := newTestFileServer(t, FileServerConfig{ETags: true})
+	etag := serve(fileServer, nil).Header().Get("ETag")
+	if etag == "" || etag[0] != '"' {
+		t.Fatalf("expected strong ETag, got %q", etag)
+	}
+
+	rsp := serve(fileServer, http.Header{"Range": {"bytes=2-4"}})
+	if rsp.Code != http.StatusPartialContent || rsp.Body.String() != "234" || rsp.Header().Get("Content-Range") != "bytes 2-4/10" {
+		t.Errorf("unexpected range response %d %q %q", rsp.Code, rsp.Header().Get("Content-Range"), rsp.Body.String())
+	}
+	rsp = serve(fileServer, http.Header{"Range": {"bytes=2-4"}, "If-Range": {etag}})
+	if rsp.Code != http.StatusPartialContent {
+		t.Errorf("expected partial content for matching If-Range, got %d", rsp.Code)
+	}
+	rsp = serve(fileServer, http.Header{"Range": {"bytes=2-4"}, "If-Range": {`"other"`}})
+	if rsp.Code != http.StatusOK || rsp.Body.String() != "0123456789" {
+		t.Errorf("expected full content for mismatching If-Range, got %d", rsp.Code)
+	}
+	rsp = serve(fileServer, http.Header{"Range": {"bytes=20-"}})
+	if rsp.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("expected range not satisfiable, got %d", rsp.Code)
+	}
+	rsp = serve(fileServer, http.Header{"If-None-Match": {etag}})
+	if rsp.Code != http.StatusNotModified {
+		t.Errorf("expected not modified, got %d", rsp.Code)
+	}
+}
+
+func TestFileServerCompressedRange(t *testing.T) {
+	fileServer := newTestFileServer(t, FileServerConfig{Compression: []string{CONTENT_ENCODING_GZIP}})
+	header := http.Header{"Range": {"bytes=2-4"}, "Accept-Encoding": {"gzip"}}
+	rsp := serve(fileServer, header)
+	if rsp.Code != http.StatusOK || rsp.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("expected full compressed response for compressible file, got %d %q", rsp.Code, rsp.Header().Get("Content-Encoding"))
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/a.bin", nil)
+	request.Header = header
+	rsp = httptest.NewRecorder()
+	fileServer.ServeHTTP(rsp, request)
+	if rsp.Code != http.StatusPartialContent || rsp.Body.String() != "234" || rsp.Header().Get("Content-Encoding") != "" {
+		t.Errorf("expected uncompressed partial content for non-compressible file, got %d %q %q", rsp.Code, rsp.Header().Get("Content-Encoding"), rsp.Body.String())
+	}
+}
+
+func TestFileServerCompressedEtag(t *testing.T) {
+	fileServer := newTestFileServer(t, FileServerConfig{ETags: true, Compression: []string{CONTENT_ENCODING_GZIP}})
+	etag := serve(fileServer, http.Header{"Accept-Encoding": {"gzip"}}).Header().Get("ETag")
+	if etag == serve(fileServer, nil).Header().Get("ETag") {
+		t.Errorf("compressed and uncompressed representations must have different ETags")
+	}
+	rsp := serve(fileServer, http.Header{"Accept-Encoding": {"gzip"}, "If-None-Match": {etag}})
+	if rsp.Code != http.StatusNotModified {
+		t.Errorf("expected not modified, got %d", rsp.Code)
+	}
+	if rsp.Header().Get("ETag") != etag {
+		t.Errorf("expected ETag %s of the compressed representation, got %s", etag, rsp.Header().Get("ETag"))
+	}
+	identityEtag := serve(fileServer, nil).Header().Get("ETag")
+	rsp = serve(fileServer, http.Header{"Accept-Encoding": {"gzip"}, "If-None-Match": {identityEtag}})
+	if rsp.Code != http.StatusOK || rsp.Header().Get("ETag") != etag {
+		t.Errorf("the identity ETag must not match the compressed representation, got %d", rsp.Code)
+	}
+	rsp = serve(fileServer, http.Header{"If-None-Match": {identityEtag}})
+	if rsp.Code != http.StatusNotModified || rsp.Header().Get("ETag") != identityEtag {
+		t.Errorf("expected not modified with the identity ETag, got %d", rsp.Code)
+	}
+}
+
+func TestMatchCacheControl(t *testing.T) {
+	var policies []CacheControlPolicy
+	for _, p := range []string{"/static/*=max-age=31536000, immutable", "*.html=no-cache", "*=max-age=60"} {
+		policy, err := ParseCacheControlPolicy(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		policies = append(policies, policy)
+	}
+	cases := map[string]string{
+		"/static/a.css":   "max-age=31536000, immutable",
+		"/static/a.html":  "max-age=31536000, immutable",
+		"/sub/index.html": "no-cache",
+		"/a.png":          "max-age=60",
+	}
+	for urlPath, expected := range cases {
+		value, _ := matchCacheControl(policies, urlPath)
+		if value != expected {
+			t.Errorf("expected %q for %s, got %q", expected, urlPath, value)
+		}
+	}
+	if _, err := ParseCacheControlPolicy("no-pattern"); err == nil {
+		t.Errorf("expected error for policy without value")
+	}
+}
@@ -25,17 +25,30 @@ func (h *hostnameDirectoryMultiplexHandler) ServeHTTP(writer http.ResponseWriter
 }
 
 func NewHostnameDirectoryMultiplexHandler(hostnameDirectory string, config FileServerConfig) (HostnameDirectoryMultiplexHandler, error) {
+	hostnames, err := ListHostnameDirectories(hostnameDirectory)
+	if err != nil {
+		return nil, err
+	}
+	inner := NewHostnameMultiplexHandler()
+	for _, hostname := range hostnames {
+		inner.AddHostname(hostname, NewFileServer(http.Dir(filepath.Join(hostnameDirectory, hostname)), config))
+	}
+	return &hostnameDirectoryMultiplexHandler{
+		inner: inner,
+	}, nil
+}
+
+// ListHostnameDirectories returns the names of the subdirectories, that are interpreted as hostnames
+func ListHostnameDirectories(hostnameDirectory string) ([]string, error) {
 	entries, err := os.ReadDir(hostnameDirectory)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list hostname directory: %v", err)
 	}
-	inner := NewHostnameMultiplexHandler()
+	hostnames := make([]string, 0, len(entries))
 	for _, entry := range entries {
 		if entry.IsDir() {
-			inner.AddHostname(entry.Name(), NewFileServer(http.Dir(filepath.Join(hostnameDirectory, entry.Name())), config))
+			hostnames = append(hostnames, entry.Name())
 		}
 	}
-	return &hostnameDirectoryMultiplexHandler{
-		inner: inner,
-	}, nil
+	return hostnames, nil
 }
@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"net"
+	"net/http"
+)
+
+// HTTPServer serves in the background, see StartHTTPServer
+type HTTPServer struct {
+	*http.Server
+	listener net.Listener
+	// receives the error of Serve, i.e. http.ErrServerClosed after the server is closed
+	Errors <-chan error
+}
+
+// StartHTTPServer binds server.Addr and serves in the background, so that bind errors are returned to the caller
+func StartHTTPServer(server *http.Server) (*HTTPServer, error) {
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return nil, err
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+	return &HTTPServer{Server: server, listener: listener, Errors: errs}, nil
+}
+
+// Close closes the server and its connections.
+// The listener is closed before Close returns, also if Serve has not started yet
+func (s *HTTPServer) Close() error {
+	err := s.Server.Close()
+	s.listener.Close()
+	return err
+}
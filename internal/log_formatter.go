@@ -1,16 +1,23 @@
 package internal
 
 import (
+	"encoding/json"
 	"fmt"
 	log "github.com/sirupsen/logrus"
 	"strings"
 	"time"
 )
 
+const (
+	LOG_FORMAT_TEXT = "text"
+	LOG_FORMAT_JSON = "json"
+)
+
 type formatter struct {
 	start time.Time
 }
 
+// NewFormatter formats entries as "LEVEL T<seconds since start> message"; fields are omitted
 func NewFormatter() log.Formatter {
 	return &formatter{
 		start: time.Now(),
@@ -20,3 +27,55 @@ func NewFormatter() log.Formatter {
 func (f *formatter) Format(entry *log.Entry) ([]byte, error) {
 	return []byte(fmt.Sprintf("%s T%f %s\n", strings.ToUpper(entry.Level.String()), time.Now().Sub(f.start).Seconds(), entry.Message)), nil
 }
+
+type jsonFormatter struct {
+	start time.Time
+}
+
+// reserved keys of the JSON formatter
+var jsonFormatterKeys = []string{"level", "t", "time", "msg"}
+
+// NewJSONFormatter formats entries as one JSON object per line,
+// with the fields of the entry and level, t (seconds since start), time and msg.
+// Fields with one of these keys are prefixed with "fields.", like by the JSON formatter of logrus
+func NewJSONFormatter() log.Formatter {
+	return &jsonFormatter{
+		start: time.Now(),
+	}
+}
+
+func (f *jsonFormatter) Format(entry *log.Entry) ([]byte, error) {
+	data := make(log.Fields, len(entry.Data)+4)
+	for key, value := range entry.Data {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		data[key] = value
+	}
+	for _, key := range jsonFormatterKeys {
+		if value, ok := data[key]; ok {
+			data["fields."+key] = value
+		}
+	}
+	data["level"] = entry.Level.String()
+	data["t"] = entry.Time.Sub(f.start).Seconds()
+	data["time"] = entry.Time.Format(time.RFC3339Nano)
+	data["msg"] = entry.Message
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal log entry: %w", err)
+	}
+	return append(b, '\n'), nil
+}
+
+// NewFormatterByName returns the formatter of LOG_FORMAT_TEXT or LOG_FORMAT_JSON
+func NewFormatterByName(name string) (log.Formatter, error) {
+	switch name {
+	case LOG_FORMAT_TEXT:
+		return NewFormatter(), nil
+	case LOG_FORMAT_JSON:
+		return NewJSONFormatter(), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", name)
+	}
+}
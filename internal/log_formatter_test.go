@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"testing"
+	"time"
+)
+
+func TestJSONFormatter(t *testing.T) {
+	f := NewJSONFormatter()
+	entry := &log.Entry{
+		Level:   log.InfoLevel,
+		Time:    time.Now(),
+		Message: "got",
+		Data:    log.Fields{"status": 200, "error": errors.New("failed")},
+	}
+	b, err := f.Format(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data map[string]interface{}
+	err = json.Unmarshal(b, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["msg"] != "got" || data["level"] != "info" || data["status"] != 200.0 || data["error"] != "failed" {
+		t.Errorf("unexpected entry %s", b)
+	}
+}
+
+func TestJSONFormatterFieldClashes(t *testing.T) {
+	f := NewJSONFormatter()
+	entry := &log.Entry{
+		Level:   log.InfoLevel,
+		Time:    time.Now(),
+		Message: "got",
+		Data:    log.Fields{"level": "field level", "t": 1, "time": "field time", "msg": "field msg"},
+	}
+	b, err := f.Format(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data map[string]interface{}
+	err = json.Unmarshal(b, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["msg"] != "got" || data["level"] != "info" || data["time"] == "field time" || data["t"] == 1.0 {
+		t.Errorf("reserved keys overwritten by fields: %s", b)
+	}
+	if data["fields.level"] != "field level" || data["fields.t"] != 1.0 || data["fields.time"] != "field time" || data["fields.msg"] != "field msg" {
+		t.Errorf("expected prefixed fields: %s", b)
+	}
+}
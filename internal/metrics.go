@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const METRICS_CONTENT_TYPE = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// DefaultDurationBuckets are the histogram buckets for durations in seconds
+var DefaultDurationBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// MetricsRegistry exposes counters and histograms in the OpenMetrics text format,
+// see https://github.com/OpenObservability/OpenMetrics/blob/main/specification/OpenMetrics.md
+type MetricsRegistry interface {
+	http.Handler
+	// Counter returns the counter of the name and label values, it is created on first use.
+	// labels are name-value pairs
+	Counter(name string, help string, labels ...string) *Counter
+	// Histogram returns the histogram of the name and label values, it is created on first use.
+	// labels are name-value pairs
+	Histogram(name string, help string, buckets []float64, labels ...string) *Histogram
+}
+
+type metricsRegistry struct {
+	mutex    sync.Mutex
+	families map[string]*metricFamily
+	// names in order of registration
+	names []string
+}
+
+type metricFamily struct {
+	typ  string
+	help string
+	// by formatted labels
+	metrics map[string]metric
+}
+
+type metric interface {
+	// write writes the samples of the metric
+	write(b *strings.Builder, name string, labels string)
+}
+
+func NewMetricsRegistry() MetricsRegistry {
+	return &metricsRegistry{
+		families: make(map[string]*metricFamily),
+	}
+}
+
+func (r *metricsRegistry) get(name string, typ string, help string, labels []string, create func() metric) metric {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	family, ok := r.families[name]
+	if !ok {
+		family = &metricFamily{typ: typ, help: help, metrics: make(map[string]metric)}
+		r.families[name] = family
+		r.names = append(r.names, name)
+	}
+	if family.typ != typ {
+		panic(fmt.Sprintf("metric %s registered as %s and %s", name, family.typ, typ))
+	}
+	key := formatLabels(labels)
+	m, ok := family.metrics[key]
+	if !ok {
+		m = create()
+		family.metrics[key] = m
+	}
+	return m
+}
+
+func (r *metricsRegistry) Counter(name string, help string, labels ...string) *Counter {
+	return r.get(name, "counter", help, labels, func() metric { return &Counter{} }).(*Counter)
+}
+
+func (r *metricsRegistry) Histogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	return r.get(name, "histogram", help, labels, func() metric {
+		return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+	}).(*Histogram)
+}
+
+func (r *metricsRegistry) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	var b strings.Builder
+	r.mutex.Lock()
+	for _, name := range r.names {
+		family := r.families[name]
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, family.typ)
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, family.help)
+		keys := make([]string, 0, len(family.metrics))
+		for key := range family.metrics {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			family.metrics[key].write(&b, name, key)
+		}
+	}
+	r.mutex.Unlock()
+	b.WriteString("# EOF\n")
+	writer.Header().Set("Content-Type", METRICS_CONTENT_TYPE)
+	_, err := writer.Write([]byte(b.String()))
+	if err != nil {
+		log.Debugf("failed to write metrics: %v", err)
+	}
+}
+
+// StartMetricsServer serves the registry on addr at /metrics in the background, until the server is closed
+func StartMetricsServer(addr string, registry MetricsRegistry) (*HTTPServer, error) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry)
+	server, err := StartHTTPServer(&http.Server{Addr: addr, Handler: mux})
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("metrics endpoint on http://%s/metrics", addr)
+	return server, nil
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	mutex sync.Mutex
+	value float64
+}
+
+func (c *Counter) Add(v float64) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	c.value += v
+	c.mutex.Unlock()
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) write(b *strings.Builder, name string, labels string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	fmt.Fprintf(b, "%s_total%s %s\n", name, labels, formatFloat(c.value))
+}
+
+// Histogram counts observations in cumulative buckets
+type Histogram struct {
+	mutex   sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *Histogram) Observe(v float64) {
+	if h == nil {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for i, upperBound := range h.buckets {
+		if v <= upperBound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *Histogram) write(b *strings.Builder, name string, labels string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for i, upperBound := range h.buckets {
+		fmt.Fprintf(b, "%s_bucket%s %d\n", name, withLabel(labels, "le", formatFloat(upperBound)), h.counts[i])
+	}
+	fmt.Fprintf(b, "%s_bucket%s %d\n", name, withLabel(labels, "le", "+Inf"), h.count)
+	fmt.Fprintf(b, "%s_sum%s %s\n", name, labels, formatFloat(h.sum))
+	fmt.Fprintf(b, "%s_count%s %d\n", name, labels, h.count)
+}
+
+// formatLabels formats name-value pairs, e.g. {category="dns"}
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	if len(labels)%2 != 0 {
+		panic("labels must be name-value pairs")
+	}
+	parts := make([]string, 0, len(labels)/2)
+	for i := 0; i < len(labels); i += 2 {
+		parts = append(parts, fmt.Sprintf("%s=%s", labels[i], strconv.Quote(labels[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// withLabel adds a label to formatted labels
+func withLabel(labels string, name string, value string) string {
+	label := fmt.Sprintf("%s=%s", name, strconv.Quote(value))
+	if labels == "" {
+		return "{" + label + "}"
+	}
+	return strings.TrimSuffix(labels, "}") + "," + label + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
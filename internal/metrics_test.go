@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetricsRegistry(t *testing.T) {
+	registry := NewMetricsRegistry()
+	registry.Counter("requests", "requests").Add(2)
+	registry.Counter("errors", "errors", "category", "dns").Inc()
+	h := registry.Histogram("duration_seconds", "duration", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+
+	rec := httptest.NewRecorder()
+	registry.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	expected := `# TYPE requests counter
+# HELP requests requests
+requests_total 2
+# TYPE errors counter
+# HELP errors errors
+errors_total{category="dns"} 1
+# TYPE duration_seconds histogram
+# HELP duration_seconds duration
+duration_seconds_bucket{le="0.1"} 1
+duration_seconds_bucket{le="1"} 2
+duration_seconds_bucket{le="+Inf"} 3
+duration_seconds_sum 5.55
+duration_seconds_count 3
+# EOF
+`
+	if rec.Body.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Type") != METRICS_CONTENT_TYPE {
+		t.Errorf("unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestNilCounter(t *testing.T) {
+	var c *Counter
+	c.Inc()
+	var h *Histogram
+	h.Observe(1)
+	var m *ConnectionMetrics
+	m.Migrated()
+}
+
+func TestStartMetricsServer(t *testing.T) {
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	addr := occupied.Addr().String()
+	_, err = StartMetricsServer(addr, NewMetricsRegistry())
+	if err == nil {
+		t.Errorf("expected bind error")
+	}
+	occupied.Close()
+
+	server, err := StartMetricsServer(addr, NewMetricsRegistry())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected status 200, got %d", res.StatusCode)
+	}
+	server.Close()
+	if err := <-server.Errors; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("expected closed server, got %v", err)
+	}
+}
@@ -1,4 +1,14 @@
 package internal
 
+import "mime"
+
 const MIME_TYPE_TEXT_CSS = "text/css"
 const MIME_TYPE_TEXT_HTML = "text/html"
+const MIME_TYPE_TEXT_JAVASCRIPT = "text/javascript"
+const MIME_TYPE_APPLICATION_JAVASCRIPT = "application/javascript"
+const MIME_TYPE_APPLICATION_MANIFEST_JSON = "application/manifest+json"
+
+func init() {
+	// not part of the builtin table of the mime package
+	_ = mime.AddExtensionType(".webmanifest", MIME_TYPE_APPLICATION_MANIFEST_JSON)
+}
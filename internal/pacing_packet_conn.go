@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// remote addresses that did not send for this duration are forgotten
+const pacingIdleTimeout = time.Minute
+
+// pacingPacketConn delays the datagrams to every remote address, so they are sent at a constant rate
+type pacingPacketConn struct {
+	net.PacketConn
+	bytesPerSecond float64
+	mutex          sync.Mutex
+	// send time of the next datagram, by remote address
+	nextSend map[string]time.Time
+	// the idle remote addresses are removed at most once per pacingIdleTimeout
+	lastCleanup time.Time
+}
+
+// NewPacingPacketConn wraps a UDP socket.
+// WriteTo blocks until the datagram may be sent.
+// Idle time is not saved up, so the rate is not exceeded by bursts.
+// Features of *net.UDPConn like ECN are not available to quic-go through the wrapper.
+func NewPacingPacketConn(conn net.PacketConn, bytesPerSecond float64) net.PacketConn {
+	return &pacingPacketConn{
+		PacketConn:     conn,
+		bytesPerSecond: bytesPerSecond,
+		nextSend:       make(map[string]time.Time),
+		lastCleanup:    time.Now(),
+	}
+}
+
+func (c *pacingPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	delay := c.delay(addr.String(), len(p), time.Now())
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+// delay returns how long a datagram of size bytes to the remote address has to wait at now
+func (c *pacingPacketConn) delay(remote string, size int, now time.Time) time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if now.Sub(c.lastCleanup) > pacingIdleTimeout {
+		for r, next := range c.nextSend {
+			if now.Sub(next) > pacingIdleTimeout {
+				delete(c.nextSend, r)
+			}
+		}
+		c.lastCleanup = now
+	}
+	next, ok := c.nextSend[remote]
+	if !ok || next.Before(now) {
+		next = now
+	}
+	c.nextSend[remote] = next.Add(time.Duration(float64(size) / c.bytesPerSecond * float64(time.Second)))
+	return next.Sub(now)
+}
+
+// SetReadBuffer passes through to the UDP socket, so quic-go can increase the receive buffer
+func (c *pacingPacketConn) SetReadBuffer(bytes int) error {
+	if conn, ok := c.PacketConn.(interface{ SetReadBuffer(int) error }); ok {
+		return conn.SetReadBuffer(bytes)
+	}
+	return nil
+}
+
+// SetWriteBuffer passes through to the UDP socket, so quic-go can increase the send buffer
+func (c *pacingPacketConn) SetWriteBuffer(bytes int) error {
+	if conn, ok := c.PacketConn.(interface{ SetWriteBuffer(int) error }); ok {
+		return conn.SetWriteBuffer(bytes)
+	}
+	return nil
+}
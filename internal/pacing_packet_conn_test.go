@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPacingPacketConnDelay(t *testing.T) {
+	// 1000 B every 10 ms
+	c := NewPacingPacketConn(nil, 100_000).(*pacingPacketConn)
+	start := time.Now()
+	for i, expected := range []time.Duration{0, 10 * time.Millisecond, 20 * time.Millisecond} {
+		if delay := c.delay("a", 1000, start); delay != expected {
+			t.Errorf("datagram %d: expected delay %s, got %s", i, expected, delay)
+		}
+	}
+	// other remote addresses are paced independently
+	if delay := c.delay("b", 1000, start); delay != 0 {
+		t.Errorf("expected no delay of another remote address, got %s", delay)
+	}
+	// idle time is not saved up
+	later := start.Add(time.Second)
+	for i, expected := range []time.Duration{0, 10 * time.Millisecond} {
+		if delay := c.delay("a", 1000, later); delay != expected {
+			t.Errorf("datagram %d after idle time: expected delay %s, got %s", i, expected, delay)
+		}
+	}
+	// idle remote addresses are forgotten
+	c.delay("a", 1000, start.Add(2*pacingIdleTimeout))
+	if _, ok := c.nextSend["b"]; ok || len(c.nextSend) != 1 {
+		t.Errorf("expected only the active remote address, got %v", c.nextSend)
+	}
+}
+
+func TestPacingPacketConn(t *testing.T) {
+	receiver, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+	sender, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	// 1000 B every 10 ms
+	c := NewPacingPacketConn(sender, 100_000)
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		_, err := c.WriteTo(make([]byte, 1000), receiver.LocalAddr())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected 6 datagrams to take at least 50 ms, took %s", elapsed)
+	}
+	buf := make([]byte, 1500)
+	n, _, err := receiver.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1000 {
+		t.Errorf("expected 1000 B datagram, got %d B", n)
+	}
+}
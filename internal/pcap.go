@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// pcapng block types, see https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-01.html
+const (
+	pcapngSectionHeaderBlock        = 0x0A0D0D0A
+	pcapngInterfaceDescriptionBlock = 0x00000001
+	pcapngEnhancedPacketBlock       = 0x00000006
+	pcapngByteOrderMagic            = 0x1A2B3C4D
+	// raw IPv4 or IPv6 packets
+	pcapngLinkTypeRaw = 101
+)
+
+// PcapWriter writes UDP datagrams with synthesized IP and UDP headers to a pcapng file.
+// Every packet is written immediately, so the file is complete even if the process is killed.
+type PcapWriter struct {
+	mutex  sync.Mutex
+	writer io.WriteCloser
+}
+
+// CreatePcapFile creates the file and writes the pcapng header
+func CreatePcapFile(filename string) (*PcapWriter, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewPcapWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// NewPcapWriter writes the pcapng section header and the interface description
+func NewPcapWriter(writer io.WriteCloser) (*PcapWriter, error) {
+	var header []byte
+	// section header block, without options
+	header = appendBlock(header, pcapngSectionHeaderBlock, func(b []byte) []byte {
+		b = binary.LittleEndian.AppendUint32(b, pcapngByteOrderMagic)
+		b = binary.LittleEndian.AppendUint16(b, 1) // major version
+		b = binary.LittleEndian.AppendUint16(b, 0) // minor version
+		return binary.LittleEndian.AppendUint64(b, 0xFFFFFFFFFFFFFFFF)
+	})
+	// interface description block, timestamps in microseconds by default
+	header = appendBlock(header, pcapngInterfaceDescriptionBlock, func(b []byte) []byte {
+		b = binary.LittleEndian.AppendUint16(b, pcapngLinkTypeRaw)
+		b = binary.LittleEndian.AppendUint16(b, 0)    // reserved
+		return binary.LittleEndian.AppendUint32(b, 0) // no snapshot length
+	})
+	_, err := writer.Write(header)
+	if err != nil {
+		return nil, err
+	}
+	return &PcapWriter{writer: writer}, nil
+}
+
+// WritePacket writes the UDP datagram sent from src to dst
+func (p *PcapWriter) WritePacket(t time.Time, src *net.UDPAddr, dst *net.UDPAddr, payload []byte) error {
+	packet, err := synthesizeUDPPacket(src, dst, payload)
+	if err != nil {
+		return err
+	}
+	timestamp := uint64(t.UnixMicro())
+	block := appendBlock(nil, pcapngEnhancedPacketBlock, func(b []byte) []byte {
+		b = binary.LittleEndian.AppendUint32(b, 0) // interface ID
+		b = binary.LittleEndian.AppendUint32(b, uint32(timestamp>>32))
+		b = binary.LittleEndian.AppendUint32(b, uint32(timestamp))
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(packet))) // captured length
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(packet))) // original length
+		b = append(b, packet...)
+		return append(b, make([]byte, padding(len(packet)))...)
+	})
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	_, err = p.writer.Write(block)
+	return err
+}
+
+func (p *PcapWriter) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.writer.Close()
+}
+
+// appendBlock appends a block with the body, that must be padded to 32 bits
+func appendBlock(b []byte, blockType uint32, body func([]byte) []byte) []byte {
+	start := len(b)
+	b = binary.LittleEndian.AppendUint32(b, blockType)
+	b = binary.LittleEndian.AppendUint32(b, 0) // length, set below
+	b = body(b)
+	length := uint32(len(b) - start + 4)
+	binary.LittleEndian.PutUint32(b[start+4:], length)
+	return binary.LittleEndian.AppendUint32(b, length)
+}
+
+func padding(length int) int {
+	return (4 - length%4) % 4
+}
+
+// synthesizeUDPPacket returns an IPv4 or IPv6 packet containing the UDP datagram.
+// IPv4 is used if both addresses are IPv4 or unspecified, e.g. for a dual-stack socket bound to [::].
+func synthesizeUDPPacket(src *net.UDPAddr, dst *net.UDPAddr, payload []byte) ([]byte, error) {
+	udpLength := 8 + len(payload)
+	if udpLength > 0xFFFF {
+		return nil, fmt.Errorf("udp datagram too large: %d byte", len(payload))
+	}
+	if isIPv4OrUnspecified(src.IP) && isIPv4OrUnspecified(dst.IP) {
+		src4, dst4 := ipv4(src.IP), ipv4(dst.IP)
+		packet := make([]byte, 20, 20+udpLength)
+		packet[0] = 0x45 // version 4, header length 20 byte
+		binary.BigEndian.PutUint16(packet[2:], uint16(20+udpLength))
+		packet[8] = 64 // TTL
+		packet[9] = 17 // UDP
+		copy(packet[12:16], src4)
+		copy(packet[16:20], dst4)
+		binary.BigEndian.PutUint16(packet[10:], ^fold(checksum(0, packet)))
+		return appendUDP(packet, src4, dst4, src.Port, dst.Port, payload), nil
+	}
+	src16, dst16 := ipv6(src.IP), ipv6(dst.IP)
+	packet := make([]byte, 40, 40+udpLength)
+	packet[0] = 0x60 // version 6
+	binary.BigEndian.PutUint16(packet[4:], uint16(udpLength))
+	packet[6] = 17 // UDP
+	packet[7] = 64 // hop limit
+	copy(packet[8:24], src16)
+	copy(packet[24:40], dst16)
+	return appendUDP(packet, src16, dst16, src.Port, dst.Port, payload), nil
+}
+
+func isIPv4OrUnspecified(ip net.IP) bool {
+	return ip == nil || ip.IsUnspecified() || ip.To4() != nil
+}
+
+// ipv4 returns the 4 byte representation, or 0.0.0.0 for unspecified addresses
+func ipv4(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return net.IPv4zero.To4()
+}
+
+// ipv6 returns the 16 byte representation, or :: for nil
+func ipv6(ip net.IP) net.IP {
+	if ip == nil {
+		return net.IPv6unspecified
+	}
+	return ip.To16()
+}
+
+// appendUDP appends the UDP header with checksum and the payload
+func appendUDP(packet []byte, src net.IP, dst net.IP, srcPort int, dstPort int, payload []byte) []byte {
+	start := len(packet)
+	length := 8 + len(payload)
+	packet = binary.BigEndian.AppendUint16(packet, uint16(srcPort))
+	packet = binary.BigEndian.AppendUint16(packet, uint16(dstPort))
+	packet = binary.BigEndian.AppendUint16(packet, uint16(length))
+	packet = binary.BigEndian.AppendUint16(packet, 0) // checksum, set below
+	packet = append(packet, payload...)
+	// pseudo header
+	var sum uint32
+	sum = checksum(sum, src)
+	sum = checksum(sum, dst)
+	sum += 17 + uint32(length)
+	sum = checksum(sum, packet[start:])
+	udpChecksum := ^fold(sum)
+	if udpChecksum == 0 {
+		udpChecksum = 0xFFFF
+	}
+	binary.BigEndian.PutUint16(packet[start+6:], udpChecksum)
+	return packet
+}
+
+// checksum adds the 16 bit words of b to the internet checksum sum
+func checksum(sum uint32, b []byte) uint32 {
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	return sum
+}
+
+func fold(sum uint32) uint16 {
+	for sum > 0xFFFF {
+		sum = (sum >> 16) + (sum & 0xFFFF)
+	}
+	return uint16(sum)
+}
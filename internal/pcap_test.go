@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+type nopWriteCloser struct {
+	bytes.Buffer
+}
+
+func (w *nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestPcapWriter(t *testing.T) {
+	out := &nopWriteCloser{}
+	w, err := NewPcapWriter(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &net.UDPAddr{IP: net.IPv6unspecified, Port: 1234}
+	dst := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 443}
+	err = w.WritePacket(time.UnixMicro(5), src, dst, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := out.Bytes()
+	// section header and interface description block
+	offset := 28 + 20
+	if binary.LittleEndian.Uint32(b[offset:]) != pcapngEnhancedPacketBlock {
+		t.Fatalf("expected enhanced packet block")
+	}
+	length := binary.LittleEndian.Uint32(b[offset+4:])
+	if int(length) != len(b)-offset || length%4 != 0 {
+		t.Errorf("unexpected block length %d", length)
+	}
+	if binary.LittleEndian.Uint32(b[offset+16:]) != 5 {
+		t.Errorf("unexpected timestamp")
+	}
+	packet := b[offset+28 : offset+28+20+8+5]
+	if packet[0] != 0x45 {
+		t.Errorf("expected IPv4 packet, got version %d", packet[0]>>4)
+	}
+	if fold(checksum(0, packet[:20])) != 0xFFFF {
+		t.Errorf("invalid IPv4 header checksum")
+	}
+	if binary.BigEndian.Uint16(packet[20:]) != 1234 || binary.BigEndian.Uint16(packet[22:]) != 443 {
+		t.Errorf("unexpected ports")
+	}
+	if string(packet[28:]) != "hello" {
+		t.Errorf("unexpected payload %q", packet[28:])
+	}
+}
+
+func TestSynthesizeIPv6Packet(t *testing.T) {
+	src := &net.UDPAddr{IP: net.ParseIP("::1"), Port: 1}
+	dst := &net.UDPAddr{IP: net.ParseIP("::1"), Port: 2}
+	packet, err := synthesizeUDPPacket(src, dst, []byte{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packet[0]>>4 != 6 || len(packet) != 40+8+3 {
+		t.Errorf("unexpected packet %x", packet)
+	}
+	// checksum over pseudo header and UDP datagram
+	sum := checksum(0, packet[8:40])
+	sum += 17 + 8 + 3
+	sum = checksum(sum, packet[40:])
+	if fold(sum) != 0xFFFF {
+		t.Errorf("invalid UDP checksum")
+	}
+}
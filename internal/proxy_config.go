@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/lucas-clemente/quic-go"
+	"io"
+)
+
+// NewProxyConfig resolves the proxy address, in the form "host:port", default port 18081 if not specified.
+// If tlsCertFile is empty, only the system certificates are trusted.
+// keyLogWriter may be nil
+func NewProxyConfig(proxy string, tlsCertFile string, keyLogWriter io.Writer) (*quic.ProxyConfig, error) {
+	proxyAddr, err := ParseResolveHost(proxy, quic.DefaultHQUICProxyControlPort)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve proxy address: %w", err)
+	}
+	proxyConf := &quic.ProxyConfig{
+		Addr: proxyAddr.String(),
+		Config: &quic.Config{
+			TokenStore: quic.NewLRUTokenStore(1, 1),
+		},
+	}
+	if tlsCertFile != "" {
+		certPool, err := SystemCertPoolWithAdditionalCert(tlsCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load proxy certificate: %w", err)
+		}
+		proxyConf.TlsConf = &tls.Config{
+			NextProtos:         []string{quic.HQUICProxyALPN},
+			ClientSessionCache: tls.NewLRUClientSessionCache(1),
+			RootCAs:            certPool,
+		}
+	}
+	if keyLogWriter != nil {
+		if proxyConf.TlsConf == nil {
+			proxyConf.TlsConf = &tls.Config{}
+		}
+		proxyConf.TlsConf.KeyLogWriter = keyLogWriter
+	}
+	return proxyConf, nil
+}
@@ -5,20 +5,100 @@ import (
 	"fmt"
 	"github.com/lucas-clemente/quic-go/logging"
 	"github.com/lucas-clemente/quic-go/qlog"
+	log "github.com/sirupsen/logrus"
 	"io"
 	"os"
+	"path/filepath"
 )
 
-func NewQlogTracer(filePrefix string, onFileCreate func(filename string)) logging.Tracer {
+const (
+	QLOG_COMPRESSION_GZIP = CONTENT_ENCODING_GZIP
+	QLOG_COMPRESSION_ZSTD = CONTENT_ENCODING_ZSTD
+)
+
+// QlogConfig selects where and how qlog files are written
+type QlogConfig struct {
+	// directory of the qlog files.
+	// if empty, the working directory is used
+	Dir string
+	// subdirectory of Dir for the files of one run.
+	// if empty, no subdirectory is used
+	RunID string
+	// prefix of the file names
+	Prefix string
+	// QLOG_COMPRESSION_GZIP or QLOG_COMPRESSION_ZSTD.
+	// if empty, files are not compressed
+	Compression string
+}
+
+// ParseQlogCompression returns an error if the compression is not supported
+func ParseQlogCompression(compression string) (string, error) {
+	switch compression {
+	case "", QLOG_COMPRESSION_GZIP, QLOG_COMPRESSION_ZSTD:
+		return compression, nil
+	default:
+		return "", fmt.Errorf("unsupported qlog compression %q, use %s or %s", compression, QLOG_COMPRESSION_GZIP, QLOG_COMPRESSION_ZSTD)
+	}
+}
+
+// NewQlogTracer writes a qlog file per connection.
+// The files are written in the NDJSON format of quic-go, not in JSON-SEQ with RFC 7464 record separators.
+// If a file can not be created, qlog is disabled for that connection.
+func NewQlogTracer(config QlogConfig, onFileCreate func(filename string)) logging.Tracer {
 	return qlog.NewTracer(func(p logging.Perspective, connectionID []byte) io.WriteCloser {
-		filename := fmt.Sprintf("%s_%x.qlog", filePrefix, connectionID)
-		f, err := os.Create(filename)
+		w, filename, err := createQlogFile(config, connectionID)
 		if err != nil {
-			panic(err)
+			log.Errorf("failed to create qlog file, qlog is disabled for connection %x: %v", connectionID, err)
+			return nil
 		}
 		if onFileCreate != nil {
 			onFileCreate(filename)
 		}
-		return NewBufferedWriteCloser(bufio.NewWriter(f), f)
+		return w
 	})
 }
+
+func createQlogFile(config QlogConfig, connectionID []byte) (io.WriteCloser, string, error) {
+	dir := filepath.Join(config.Dir, config.RunID)
+	if dir != "" {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	filename := filepath.Join(dir, fmt.Sprintf("%s_%x.qlog", config.Prefix, connectionID))
+	switch config.Compression {
+	case QLOG_COMPRESSION_GZIP:
+		filename += ".gz"
+	case QLOG_COMPRESSION_ZSTD:
+		filename += ".zst"
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, "", err
+	}
+	file := NewBufferedWriteCloser(bufio.NewWriter(f), f)
+	if config.Compression == "" {
+		return file, filename, nil
+	}
+	encoder, err := NewContentEncoder(config.Compression, file)
+	if err != nil {
+		file.Close()
+		return nil, "", err
+	}
+	return &compressedWriteCloser{WriteCloser: encoder, file: file}, filename, nil
+}
+
+// compressedWriteCloser closes the file after flushing the encoder
+type compressedWriteCloser struct {
+	io.WriteCloser
+	file io.Closer
+}
+
+func (c *compressedWriteCloser) Close() error {
+	if err := c.WriteCloser.Close(); err != nil {
+		c.file.Close()
+		return err
+	}
+	return c.file.Close()
+}
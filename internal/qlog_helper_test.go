@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateQlogFile(t *testing.T) {
+	dir := t.TempDir()
+	w, filename, err := createQlogFile(QlogConfig{Dir: dir, RunID: "run", Prefix: "client", Compression: QLOG_COMPRESSION_GZIP}, []byte{0xab, 0xcd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filename != filepath.Join(dir, "run", "client_abcd.qlog.gz") {
+		t.Errorf("unexpected filename %s", filename)
+	}
+	_, err = w.Write([]byte("{}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "{}\n" {
+		t.Errorf("unexpected content %q", content)
+	}
+}
+
+func TestCreateQlogFileError(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(file, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a file is in place of the directory
+	_, _, err = createQlogFile(QlogConfig{Dir: file, Prefix: "client"}, []byte{0x01})
+	if err == nil {
+		t.Errorf("expected error")
+	}
+}
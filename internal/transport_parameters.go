@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/lucas-clemente/quic-go"
+	"time"
+)
+
+// defaults of quic-go, see internal/protocol/params.go
+const (
+	defaultInitialStreamReceiveWindow     = 512 << 10
+	defaultMaxStreamReceiveWindow         = 6 << 20
+	defaultInitialConnectionReceiveWindow = 768 << 10
+	defaultMaxConnectionReceiveWindow     = 15 << 20
+	defaultMaxIncomingStreams             = 100
+	defaultMaxIncomingUniStreams          = 100
+	defaultMaxIdleTimeout                 = 30 * time.Second
+	defaultHandshakeIdleTimeout           = 5 * time.Second
+)
+
+// TransportParameters are the tunable QUIC transport settings of client and server.
+// Zero values select the quic-go defaults.
+type TransportParameters struct {
+	InitialStreamReceiveWindow     uint64
+	MaxStreamReceiveWindow         uint64
+	InitialConnectionReceiveWindow uint64
+	MaxConnectionReceiveWindow     uint64
+	// negative values mean that the peer must not open streams
+	MaxIncomingStreams    int64
+	MaxIncomingUniStreams int64
+	MaxIdleTimeout        time.Duration
+	// 0 means no keep-alive packets are sent
+	KeepAlivePeriod      time.Duration
+	HandshakeIdleTimeout time.Duration
+	EnableDatagrams      bool
+}
+
+// Apply sets the transport parameters in the QUIC config
+func (t TransportParameters) Apply(conf *quic.Config) {
+	conf.InitialStreamReceiveWindow = t.InitialStreamReceiveWindow
+	conf.MaxStreamReceiveWindow = t.MaxStreamReceiveWindow
+	conf.InitialConnectionReceiveWindow = t.InitialConnectionReceiveWindow
+	conf.MaxConnectionReceiveWindow = t.MaxConnectionReceiveWindow
+	conf.MaxIncomingStreams = t.MaxIncomingStreams
+	conf.MaxIncomingUniStreams = t.MaxIncomingUniStreams
+	conf.MaxIdleTimeout = t.MaxIdleTimeout
+	conf.KeepAlivePeriod = t.KeepAlivePeriod
+	conf.HandshakeIdleTimeout = t.HandshakeIdleTimeout
+	conf.EnableDatagrams = t.EnableDatagrams
+}
+
+// Effective returns the transport parameters with the quic-go defaults for unset values
+func (t TransportParameters) Effective() TransportParameters {
+	if t.InitialStreamReceiveWindow == 0 {
+		t.InitialStreamReceiveWindow = defaultInitialStreamReceiveWindow
+	}
+	if t.MaxStreamReceiveWindow == 0 {
+		t.MaxStreamReceiveWindow = defaultMaxStreamReceiveWindow
+	}
+	if t.InitialConnectionReceiveWindow == 0 {
+		t.InitialConnectionReceiveWindow = defaultInitialConnectionReceiveWindow
+	}
+	if t.MaxConnectionReceiveWindow == 0 {
+		t.MaxConnectionReceiveWindow = defaultMaxConnectionReceiveWindow
+	}
+	if t.MaxIncomingStreams == 0 {
+		t.MaxIncomingStreams = defaultMaxIncomingStreams
+	} else if t.MaxIncomingStreams < 0 {
+		t.MaxIncomingStreams = 0
+	}
+	if t.MaxIncomingUniStreams == 0 {
+		t.MaxIncomingUniStreams = defaultMaxIncomingUniStreams
+	} else if t.MaxIncomingUniStreams < 0 {
+		t.MaxIncomingUniStreams = 0
+	}
+	if t.MaxIdleTimeout == 0 {
+		t.MaxIdleTimeout = defaultMaxIdleTimeout
+	}
+	if t.HandshakeIdleTimeout == 0 {
+		t.HandshakeIdleTimeout = defaultHandshakeIdleTimeout
+	}
+	return t
+}
+
+func (t TransportParameters) String() string {
+	return fmt.Sprintf("initial stream receive window: %d B, max stream receive window: %d B, initial connection receive window: %d B, max connection receive window: %d B, max incoming streams: %d, max incoming uni streams: %d, max idle timeout: %s, keep-alive period: %s, handshake idle timeout: %s, datagrams: %t",
+		t.InitialStreamReceiveWindow,
+		t.MaxStreamReceiveWindow,
+		t.InitialConnectionReceiveWindow,
+		t.MaxConnectionReceiveWindow,
+		t.MaxIncomingStreams,
+		t.MaxIncomingUniStreams,
+		t.MaxIdleTimeout,
+		t.KeepAlivePeriod,
+		t.HandshakeIdleTimeout,
+		t.EnableDatagrams,
+	)
+}
@@ -2,25 +2,47 @@ package main
 
 import (
 	"bufio"
-	"crypto/tls"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/lucas-clemente/quic-go"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
+	"http-perf-go/analyze"
+	"http-perf-go/bench"
+	"http-perf-go/certgen"
 	"http-perf-go/client"
+	"http-perf-go/experiment"
 	"http-perf-go/internal"
+	"http-perf-go/relay"
 	"http-perf-go/server"
+	"io"
+	"io/fs"
+	"net"
 	u "net/url"
 	"os"
+	"os/signal"
 	"regexp"
+	"strings"
+	"syscall"
+	"time"
 )
 
 const (
-	defaultTLSCertificateFile = "./server.crt"
-	defaultTLSKeyFile         = "./server.key"
-	defaultServeDir           = "./www"
-	defaultServerAddr         = "0.0.0.0:8080"
-	defaultUserAgent          = "http-perf-go"
+	defaultTLSCertificateFile  = "./server.crt"
+	defaultTLSKeyFile          = "./server.key"
+	defaultCACertificateFile   = "./ca.crt"
+	defaultCAKeyFile           = "./ca.key"
+	defaultCertificateValidity = 10 * 365 * 24 * time.Hour
+	defaultServeDir            = "./www"
+	defaultServerAddr          = "0.0.0.0:8080"
+	defaultRelayAddr           = "0.0.0.0:8081"
+	defaultUserAgent           = "http-perf-go"
+	defaultRetryBackoff        = 100 * time.Millisecond
+	defaultMaxLinkDepth        = 5
+	defaultMaxPages            = 100
+	defaultAcceptEncoding      = "gzip"
+	defaultBenchSize           = "10MB"
 )
 
 // TODO add xse option
@@ -29,12 +51,48 @@ func main() {
 	app := &cli.App{
 		Name:  "http-perf-go",
 		Usage: "A performance measurement tool for HTTP/3",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "log-level",
+				Usage: "minimum level of log messages, one of \"trace\", \"debug\", \"info\", \"warn\", \"error\"",
+				Value: "info",
+			},
+			&cli.StringFlag{
+				Name:  "log-format",
+				Usage: "format of log messages, \"text\" or \"json\" with structured fields",
+				Value: internal.LOG_FORMAT_TEXT,
+			},
+			&cli.StringFlag{
+				Name:  "log-file",
+				Usage: "append log messages to this file instead of stderr",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			level, err := log.ParseLevel(c.String("log-level"))
+			if err != nil {
+				return err
+			}
+			log.SetLevel(level)
+			formatter, err := internal.NewFormatterByName(c.String("log-format"))
+			if err != nil {
+				return err
+			}
+			log.SetFormatter(formatter)
+			if c.IsSet("log-file") {
+				file, err := os.OpenFile(c.String("log-file"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+				if err != nil {
+					return fmt.Errorf("failed to open log file: %w", err)
+				}
+				log.SetOutput(file)
+			}
+			return nil
+		},
 		Commands: []*cli.Command{
 			{
 				Name:      "client",
 				Usage:     "run in client mode",
 				ArgsUsage: "[URL...]",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:  "tls-cert",
 						Usage: "TLS certificate file to use",
@@ -42,7 +100,7 @@ func main() {
 					},
 					&cli.BoolFlag{
 						Name:  "qlog",
-						Usage: "create qlog file",
+						Usage: "create a qlog file per connection, in the NDJSON format of quic-go, one JSON record per line without the RFC 7464 record separators of JSON-SEQ",
 						Value: false,
 					},
 					&cli.BoolFlag{
@@ -84,6 +142,63 @@ func main() {
 						Name:  "url-blacklist",
 						Usage: "file containing regular expressions for urls that will not be requested",
 					},
+					&cli.StringFlag{
+						Name:  "url-allowlist",
+						Usage: "file containing regular expressions for urls that will be requested; all other urls are skipped",
+					},
+					&cli.IntFlag{
+						Name:  "max-depth",
+						Usage: "maximum recursion depth of page requisites; -1 for unlimited",
+						Value: -1,
+					},
+					&cli.BoolFlag{
+						Name:  "same-host",
+						Usage: "only request page requisites and follow links on the hosts of the initial urls and --domains (default)",
+						Value: false,
+					},
+					&cli.BoolFlag{
+						Name:    "span-hosts",
+						Aliases: []string{"H"},
+						Usage:   "request page requisites and follow links on all hosts, or only on --domains if set, like wget -H",
+						Value:   false,
+					},
+					&cli.StringFlag{
+						Name:    "domains",
+						Aliases: []string{"D"},
+						Usage:   "comma-separated list of domains to request page requisites from, including subdomains",
+					},
+					&cli.UintFlag{
+						Name:  "max-requests",
+						Usage: "maximum number of requests; 0 for unlimited",
+						Value: 0,
+					},
+					&cli.StringFlag{
+						Name:  "accept-encoding",
+						Usage: "value of the Accept-Encoding request header, e.g. \"gzip, br, zstd\"; empty to only accept uncompressed responses",
+						Value: defaultAcceptEncoding,
+					},
+					&cli.BoolFlag{
+						Name:  "repeat-view",
+						Usage: "load the pages a second time with the HTTP cache of the first view, using conditional requests for stale responses",
+						Value: false,
+					},
+					&cli.BoolFlag{
+						Name:    "recursive",
+						Aliases: []string{"r"},
+						Usage:   "follow hyperlinks and load the linked pages one after another, like a user navigating the site",
+						Value:   false,
+					},
+					&cli.UintFlag{
+						Name:    "level",
+						Aliases: []string{"l"},
+						Usage:   "maximum number of hyperlinks followed from an initial url in recursive mode",
+						Value:   defaultMaxLinkDepth,
+					},
+					&cli.UintFlag{
+						Name:  "max-pages",
+						Usage: "maximum number of pages loaded in recursive mode",
+						Value: defaultMaxPages,
+					},
 					&cli.BoolFlag{
 						Name:  "xse",
 						Usage: "use XSE-QUIC extension; handshake will fail if not supported by server",
@@ -94,7 +209,82 @@ func main() {
 						Usage: "the prefix of the qlog file name",
 						Value: "client",
 					},
-				},
+					&cli.StringFlag{
+						Name:    "qlog-dir",
+						Usage:   "directory of the qlog files, enables qlog; the files of a run are written to a subdirectory named by the run ID",
+						EnvVars: []string{"QLOGDIR"},
+					},
+					&cli.StringFlag{
+						Name:  "qlog-compression",
+						Usage: "compress qlog files, \"gzip\" or \"zstd\"",
+					},
+					&cli.StringFlag{
+						Name:  "run-id",
+						Usage: "name of the qlog subdirectory of this run; generated from the start time if not set",
+					},
+					&cli.StringFlag{
+						Name:    "keylog-file",
+						Usage:   "append TLS secrets in the NSS key log format to this file, to decrypt packet captures e.g. with Wireshark",
+						EnvVars: []string{"SSLKEYLOGFILE"},
+					},
+					&cli.StringFlag{
+						Name:  "pcap-file",
+						Usage: "write all sent and received UDP datagrams with synthesized IP and UDP headers to this pcapng file",
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Usage: "timeout of a single request including the response body; 0 for no timeout",
+						Value: 0,
+					},
+					&cli.DurationFlag{
+						Name:  "run-timeout",
+						Usage: "timeout of the whole run; 0 for no timeout",
+						Value: 0,
+					},
+					&cli.UintFlag{
+						Name:  "retries",
+						Usage: "number of retries of a request after a network, QUIC or stream error, or a request timeout",
+						Value: 0,
+					},
+					&cli.DurationFlag{
+						Name:  "retry-backoff",
+						Usage: "wait time before the first retry, doubled for every further retry",
+						Value: defaultRetryBackoff,
+					},
+					&cli.UintFlag{
+						Name:  "segments",
+						Usage: "download the initial urls in this number of parallel range requests; 0 or 1 for a single request",
+						Value: 0,
+					},
+					&cli.UintFlag{
+						Name:  "segment-connections",
+						Usage: "number of QUIC connections the segments are distributed over, round-robin",
+						Value: 1,
+					},
+					&cli.UintFlag{
+						Name:  "connections-per-host",
+						Usage: "number of QUIC connections per host; requests are distributed round-robin",
+						Value: 1,
+					},
+					&cli.BoolFlag{
+						Name:  "new-connection-per-request",
+						Usage: "open a new QUIC connection for every request",
+						Value: false,
+					},
+					&cli.UintFlag{
+						Name:  "max-streams",
+						Usage: "maximum number of concurrent requests per QUIC connection; 0 for unlimited; not supported with --new-connection-per-request",
+						Value: 0,
+					},
+					&cli.StringFlag{
+						Name:  "migrate-after",
+						Usage: "migrate the open QUIC connections to new UDP sockets after a duration, e.g. \"2s\", or after a number of received bytes, e.g. \"10MB\"; the new sockets are bound to 0.0.0.0 and a new ephemeral port, choosing the local address is not supported by quic-go",
+					},
+					&cli.StringFlag{
+						Name:  "metrics-addr",
+						Usage: "address of the HTTP endpoint serving OpenMetrics at /metrics, e.g. \"127.0.0.1:9101\"; disabled if not set",
+					},
+				}, transportParameterFlags()...),
 				Action: func(c *cli.Context) error {
 					if c.Args().Len() == 0 {
 						return fmt.Errorf("missing URL")
@@ -109,29 +299,17 @@ func main() {
 						urls = append(urls, url)
 					}
 
+					keyLogWriter, err := openKeyLogFile(c)
+					if err != nil {
+						return err
+					}
+
 					var proxyConf *quic.ProxyConfig
 					if c.IsSet("proxy") {
-						proxyConf = &quic.ProxyConfig{}
-						proxyAddr, err := internal.ParseResolveHost(c.String("proxy"), quic.DefaultHQUICProxyControlPort)
+						proxyConf, err = internal.NewProxyConfig(c.String("proxy"), c.String("tls-proxy-cert"), keyLogWriter)
 						if err != nil {
-							return fmt.Errorf("failed to resolve proxy address: %w", err)
+							return err
 						}
-						proxyConf.Addr = proxyAddr.String()
-						proxyConf.Config = &quic.Config{
-							TokenStore: quic.NewLRUTokenStore(1, 1),
-						}
-						if c.String("tls-proxy-cert") != "" {
-							proxyConf.TlsConf = &tls.Config{
-								NextProtos:         []string{quic.HQUICProxyALPN},
-								ClientSessionCache: tls.NewLRUClientSessionCache(1),
-							}
-							certPool, err := internal.SystemCertPoolWithAdditionalCert(c.String("tls-proxy-cert"))
-							if err != nil {
-								return fmt.Errorf("failed to load proxy certificate: %w", err)
-							}
-							proxyConf.TlsConf.RootCAs = certPool
-						}
-
 						if c.IsSet("proxy-0rtt") {
 							err := internal.PingToGatherSessionTicketAndToken(proxyConf.Addr, proxyConf.TlsConf, proxyConf.Config)
 							if err != nil {
@@ -143,40 +321,105 @@ func main() {
 
 					urlBlacklist := make([]*regexp.Regexp, 0)
 					if c.IsSet("url-blacklist") {
-						file, err := os.Open(c.String("url-blacklist"))
+						var err error
+						urlBlacklist, err = readRegexpFile(c.String("url-blacklist"))
 						if err != nil {
-							return fmt.Errorf("failed to open url blacklist: %v", err)
+							return fmt.Errorf("failed to read url blacklist: %v", err)
 						}
-						defer file.Close()
-						scanner := bufio.NewScanner(file)
-						for scanner.Scan() {
-							expr, err := regexp.Compile(scanner.Text())
-							if err != nil {
-								return fmt.Errorf("failed to compile url blacklist regexp: %v", err)
-							}
-							urlBlacklist = append(urlBlacklist, expr)
+					}
+
+					urlAllowlist := make([]*regexp.Regexp, 0)
+					if c.IsSet("url-allowlist") {
+						var err error
+						urlAllowlist, err = readRegexpFile(c.String("url-allowlist"))
+						if err != nil {
+							return fmt.Errorf("failed to read url allowlist: %v", err)
+						}
+					}
+
+					if c.Bool("new-connection-per-request") && c.IsSet("connections-per-host") {
+						return fmt.Errorf("--new-connection-per-request and --connections-per-host are mutually exclusive")
+					}
+					if c.Bool("new-connection-per-request") && c.IsSet("max-streams") {
+						return fmt.Errorf("--new-connection-per-request and --max-streams are mutually exclusive")
+					}
+
+					var migrateAfterDuration time.Duration
+					var migrateAfterBytes int64
+					if c.IsSet("migrate-after") {
+						var err error
+						migrateAfterDuration, migrateAfterBytes, err = parseDurationOrByteCount(c.String("migrate-after"))
+						if err != nil {
+							return fmt.Errorf("invalid --migrate-after: %v", err)
 						}
 					}
 
+					transportParameters, err := transportParametersFromContext(c)
+					if err != nil {
+						return err
+					}
+					congestionControl, err := congestionControlFromContext(c)
+					if err != nil {
+						return err
+					}
+					qlog, qlogConfig, err := qlogConfigFromContext(c)
+					if err != nil {
+						return err
+					}
+
+					if c.Bool("same-host") && c.Bool("span-hosts") {
+						return fmt.Errorf("--same-host and --span-hosts are mutually exclusive")
+					}
+					var domains []string
+					if c.IsSet("domains") {
+						domains = splitList(c.String("domains"))
+					}
+
 					return client.Run(client.Config{
-						Urls:                  urls,
-						TLSCertFile:           c.String("tls-cert"),
-						Qlog:                  c.Bool("qlog"),
-						QlogPrefix:            c.String("qlog-prefix"),
-						PageRequisites:        c.Bool("page-requisites"),
-						ParallelRequests:      c.Int("parallel"),
-						ProxyConfig:           proxyConf,
-						AllowEarlyHandover:    c.Bool("early-handover"),
-						ExtraStreamEncryption: c.Bool("xse"),
-						UserAgent:             c.String("user-agent"),
-						UrlBlacklist:          urlBlacklist,
+						Urls:                    urls,
+						TLSCertFile:             clientTLSCertFile(c),
+						Qlog:                    qlog,
+						QlogConfig:              qlogConfig,
+						KeyLogWriter:            keyLogWriter,
+						PcapFile:                c.String("pcap-file"),
+						PageRequisites:          c.Bool("page-requisites"),
+						ParallelRequests:        c.Int("parallel"),
+						ProxyConfig:             proxyConf,
+						AllowEarlyHandover:      c.Bool("early-handover"),
+						ExtraStreamEncryption:   c.Bool("xse"),
+						UserAgent:               c.String("user-agent"),
+						UrlBlacklist:            urlBlacklist,
+						UrlAllowlist:            urlAllowlist,
+						MaxDepth:                c.Int("max-depth"),
+						SpanHosts:               c.Bool("span-hosts"),
+						Domains:                 domains,
+						MaxRequests:             c.Int("max-requests"),
+						AcceptEncoding:          c.String("accept-encoding"),
+						RepeatView:              c.Bool("repeat-view"),
+						Recursive:               c.Bool("recursive"),
+						MaxLinkDepth:            c.Int("level"),
+						MaxPages:                c.Int("max-pages"),
+						RequestTimeout:          c.Duration("timeout"),
+						RunTimeout:              c.Duration("run-timeout"),
+						Retries:                 c.Int("retries"),
+						RetryBackoff:            c.Duration("retry-backoff"),
+						Segments:                c.Int("segments"),
+						SegmentConnections:      c.Int("segment-connections"),
+						ConnectionsPerHost:      c.Int("connections-per-host"),
+						NewConnectionPerRequest: c.Bool("new-connection-per-request"),
+						MaxStreams:              c.Int("max-streams"),
+						MigrateAfterDuration:    migrateAfterDuration,
+						MigrateAfterBytes:       migrateAfterBytes,
+						TransportParameters:     transportParameters,
+						CongestionControl:       congestionControl,
+						MetricsAddr:             c.String("metrics-addr"),
 					})
 				},
 			},
 			{
 				Name:  "server",
 				Usage: "run in server mode",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:  "addr",
 						Usage: "IP address and UDP port to listen on",
@@ -204,7 +447,7 @@ func main() {
 					},
 					&cli.BoolFlag{
 						Name:  "qlog",
-						Usage: "create qlog file",
+						Usage: "create a qlog file per connection, in the NDJSON format of quic-go, one JSON record per line without the RFC 7464 record separators of JSON-SEQ",
 						Value: false,
 					},
 					&cli.BoolFlag{
@@ -217,17 +460,340 @@ func main() {
 						Usage: "the prefix of the qlog file name",
 						Value: "server",
 					},
-				},
+					&cli.StringFlag{
+						Name:    "qlog-dir",
+						Usage:   "directory of the qlog files, enables qlog; the files of a run are written to a subdirectory named by the run ID",
+						EnvVars: []string{"QLOGDIR"},
+					},
+					&cli.StringFlag{
+						Name:  "qlog-compression",
+						Usage: "compress qlog files, \"gzip\" or \"zstd\"",
+					},
+					&cli.StringFlag{
+						Name:  "run-id",
+						Usage: "name of the qlog subdirectory of this run; generated from the start time if not set",
+					},
+					&cli.StringFlag{
+						Name:    "keylog-file",
+						Usage:   "append TLS secrets in the NSS key log format to this file, to decrypt packet captures e.g. with Wireshark",
+						EnvVars: []string{"SSLKEYLOGFILE"},
+					},
+					&cli.StringFlag{
+						Name:  "pcap-file",
+						Usage: "write all sent and received UDP datagrams with synthesized IP and UDP headers to this pcapng file",
+					},
+					&cli.StringFlag{
+						Name:  "compress",
+						Usage: "comma-separated content encodings to compress responses on the fly, in order of preference (gzip, br, zstd)",
+					},
+					&cli.BoolFlag{
+						Name:  "precompressed",
+						Usage: "serve precompressed files (file.br, file.zst, file.gz) if accepted by the client",
+						Value: false,
+					},
+					&cli.StringSliceFlag{
+						Name:  "cache-control",
+						Usage: "set the Cache-Control header for matching paths, e.g. \"*.css=max-age=3600\"; the first matching pattern applies",
+					},
+					&cli.BoolFlag{
+						Name:  "etag",
+						Usage: "set strong ETags derived from the file content",
+						Value: false,
+					},
+					&cli.StringFlag{
+						Name:  "admin-addr",
+						Usage: "address of the admin HTTP endpoint serving connection and request statistics as JSON at /stats, e.g. \"127.0.0.1:8082\"; disabled if not set",
+					},
+					&cli.StringFlag{
+						Name:  "metrics-addr",
+						Usage: "address of the HTTP endpoint serving OpenMetrics at /metrics, e.g. \"127.0.0.1:9102\"; disabled if not set",
+					},
+				}, transportParameterFlags()...),
 				Action: func(c *cli.Context) error {
-					return server.Run(server.Config{
+					var compression []string
+					if c.IsSet("compress") {
+						compression = strings.Split(c.String("compress"), ",")
+						for i, encoding := range compression {
+							compression[i] = strings.TrimSpace(encoding)
+							_, err := internal.NewContentEncoder(compression[i], io.Discard)
+							if err != nil {
+								return err
+							}
+						}
+					}
+					transportParameters, err := transportParametersFromContext(c)
+					if err != nil {
+						return err
+					}
+					congestionControl, err := congestionControlFromContext(c)
+					if err != nil {
+						return err
+					}
+					qlog, qlogConfig, err := qlogConfigFromContext(c)
+					if err != nil {
+						return err
+					}
+					keyLogWriter, err := openKeyLogFile(c)
+					if err != nil {
+						return err
+					}
+					var cacheControl []internal.CacheControlPolicy
+					for _, policy := range c.StringSlice("cache-control") {
+						parsed, err := internal.ParseCacheControlPolicy(policy)
+						if err != nil {
+							return err
+						}
+						cacheControl = append(cacheControl, parsed)
+					}
+					// stop gracefully, e.g. to remove the ephemeral certificate file
+					ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+					defer stop()
+					return server.RunContext(ctx, server.Config{
 						Addr:                  c.String("addr"),
 						ServeDir:              c.String("dir"),
 						TlsCertFile:           c.String("tls-cert"),
 						TlsKeyFile:            c.String("tls-key"),
-						Qlog:                  c.Bool("qlog"),
-						QlogPrefix:            c.String("qlog-prefix"),
+						Qlog:                  qlog,
+						QlogConfig:            qlogConfig,
+						KeyLogWriter:          keyLogWriter,
+						PcapFile:              c.String("pcap-file"),
 						MultiDomain:           c.Bool("multi-domain"),
 						QueryStringInFilename: c.Bool("query-in-filename"),
+						Compression:           compression,
+						Precompressed:         c.Bool("precompressed"),
+						CacheControl:          cacheControl,
+						ETags:                 c.Bool("etag"),
+						TransportParameters:   transportParameters,
+						CongestionControl:     congestionControl,
+						AdminAddr:             c.String("admin-addr"),
+						MetricsAddr:           c.String("metrics-addr"),
+					})
+				},
+			},
+			{
+				Name:      "experiment",
+				Usage:     "run the client for every combination of the parameters of a YAML or JSON spec, and write the summaries of all runs to a dataset",
+				ArgsUsage: "SPEC FILE",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "output",
+						Usage: "CSV or JSON file of the dataset; the aggregates of a CSV dataset are written to <name>_aggregates.csv",
+					},
+					&cli.StringFlag{
+						Name:  "tls-cert",
+						Usage: "TLS certificate file to use",
+						Value: defaultTLSCertificateFile,
+					},
+					&cli.StringFlag{
+						Name:  "tls-proxy-cert",
+						Usage: "certificate file to trust the proxies",
+					},
+				}, clientTemplateFlags()...),
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return fmt.Errorf("expected exactly one spec file")
+					}
+					spec, err := experiment.ReadSpec(c.Args().First())
+					if err != nil {
+						return err
+					}
+					clientConfig, keyLogWriter, err := clientTemplateFromContext(c)
+					if err != nil {
+						return err
+					}
+					clientConfig.TLSCertFile = clientTLSCertFile(c)
+					return experiment.Run(experiment.Config{
+						Spec:             spec,
+						Client:           clientConfig,
+						TLSProxyCertFile: c.String("tls-proxy-cert"),
+						KeyLogWriter:     keyLogWriter,
+						Output:           c.String("output"),
+					})
+				},
+			},
+			{
+				Name:  "bench",
+				Usage: "start a server with a generated certificate and generated files on an ephemeral port, and run the client against it",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "size",
+						Usage: "total size of the generated files, e.g. \"10MB\"",
+						Value: defaultBenchSize,
+					},
+					&cli.UintFlag{
+						Name:  "objects",
+						Usage: "number of page requisites of a generated HTML page, the size is split over; 0 for a single file",
+						Value: 0,
+					},
+					&cli.UintFlag{
+						Name:  "runs",
+						Usage: "number of client runs",
+						Value: 1,
+					},
+					&cli.BoolFlag{
+						Name:  "xse",
+						Usage: "use XSE-QUIC extension",
+						Value: false,
+					},
+				}, clientTemplateFlags()...),
+				Action: func(c *cli.Context) error {
+					size, err := internal.ParseByteCount(c.String("size"))
+					if err != nil {
+						return fmt.Errorf("invalid --size: %w", err)
+					}
+					clientConfig, _, err := clientTemplateFromContext(c)
+					if err != nil {
+						return err
+					}
+					clientConfig.ExtraStreamEncryption = c.Bool("xse")
+					serverQlogConfig := clientConfig.QlogConfig
+					serverQlogConfig.Prefix = "server"
+					_, err = bench.Run(bench.Config{
+						Size:    size,
+						Objects: c.Int("objects"),
+						Runs:    c.Int("runs"),
+						Client:  clientConfig,
+						Server: server.Config{
+							Qlog:                clientConfig.Qlog,
+							QlogConfig:          serverQlogConfig,
+							KeyLogWriter:        clientConfig.KeyLogWriter,
+							TransportParameters: clientConfig.TransportParameters,
+							CongestionControl:   clientConfig.CongestionControl,
+						},
+					})
+					return err
+				},
+			},
+			{
+				Name:  "certgen",
+				Usage: "create a CA, if it does not exist yet, and a server certificate signed by it; clients trust the server with --tls-cert <ca cert>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "ca-cert",
+						Usage: "CA certificate file, created if it does not exist",
+						Value: defaultCACertificateFile,
+					},
+					&cli.StringFlag{
+						Name:  "ca-key",
+						Usage: "CA key file, created if the CA certificate does not exist",
+						Value: defaultCAKeyFile,
+					},
+					&cli.StringFlag{
+						Name:  "tls-cert",
+						Usage: "server certificate file to create",
+						Value: defaultTLSCertificateFile,
+					},
+					&cli.StringFlag{
+						Name:  "tls-key",
+						Usage: "server key file to create",
+						Value: defaultTLSKeyFile,
+					},
+					&cli.StringSliceFlag{
+						Name:  "hostname",
+						Usage: "hostname of the server certificate, can be repeated",
+						Value: cli.NewStringSlice("localhost"),
+					},
+					&cli.StringSliceFlag{
+						Name:  "ip",
+						Usage: "IP address of the server certificate, can be repeated",
+						Value: cli.NewStringSlice("127.0.0.1", "::1"),
+					},
+					&cli.StringFlag{
+						Name:  "multi-domain-dir",
+						Usage: "add the names of the subdirectories as hostnames, like the server in multi-domain mode",
+					},
+					&cli.DurationFlag{
+						Name:  "validity",
+						Usage: "validity of the certificates",
+						Value: defaultCertificateValidity,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					var ips []net.IP
+					for _, ipStr := range c.StringSlice("ip") {
+						ip := net.ParseIP(ipStr)
+						if ip == nil {
+							return fmt.Errorf("invalid ip %s", ipStr)
+						}
+						ips = append(ips, ip)
+					}
+					return certgen.Run(certgen.Config{
+						CACertFile:     c.String("ca-cert"),
+						CAKeyFile:      c.String("ca-key"),
+						CertFile:       c.String("tls-cert"),
+						KeyFile:        c.String("tls-key"),
+						Hostnames:      c.StringSlice("hostname"),
+						IPs:            ips,
+						MultiDomainDir: c.String("multi-domain-dir"),
+						Validity:       c.Duration("validity"),
+					})
+				},
+			},
+			{
+				Name:      "analyze",
+				Usage:     "print handshake duration, RTT, losses, congestion window and stream timelines of qlog files",
+				ArgsUsage: "[QLOG FILE or DIRECTORY...]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "csv-dir",
+						Usage: "directory to write CSV files of the metrics and stream timelines to, for plotting",
+					},
+					&cli.DurationFlag{
+						Name:  "interval",
+						Usage: "print RTT, congestion window and stream bytes in this interval, e.g. \"100ms\"; only the summary is printed if not set",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() == 0 {
+						return fmt.Errorf("no qlog file specified")
+					}
+					return analyze.Run(analyze.Config{
+						Paths:    c.Args().Slice(),
+						CSVDir:   c.String("csv-dir"),
+						Interval: c.Duration("interval"),
+					})
+				},
+			},
+			{
+				Name:  "rebind-relay",
+				Usage: "run a UDP relay in front of the server, that changes the source port of client traffic like a NAT rebinding",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "addr",
+						Usage: "IP address and UDP port to listen on",
+						Value: defaultRelayAddr,
+					},
+					&cli.StringFlag{
+						Name:     "server",
+						Usage:    "address of the server, in the form \"host:port\"",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "rebind-at",
+						Usage: "comma-separated times after the first packet of a client, when the source port is changed, e.g. \"1s,2.5s\"",
+					},
+					&cli.DurationFlag{
+						Name:  "rebind-interval",
+						Usage: "change the source port periodically; 0 for no periodic rebinding",
+						Value: 0,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					var rebindAt []time.Duration
+					if c.IsSet("rebind-at") {
+						for _, at := range strings.Split(c.String("rebind-at"), ",") {
+							duration, err := time.ParseDuration(at)
+							if err != nil {
+								return fmt.Errorf("invalid --rebind-at: %v", err)
+							}
+							rebindAt = append(rebindAt, duration)
+						}
+					}
+					return relay.Run(relay.Config{
+						Addr:           c.String("addr"),
+						ServerAddr:     c.String("server"),
+						RebindAt:       rebindAt,
+						RebindInterval: c.Duration("rebind-interval"),
 					})
 				},
 			},
@@ -240,3 +806,300 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// readRegexpFile compiles every line of the file as regular expression
+func readRegexpFile(filename string) ([]*regexp.Regexp, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	expressions := make([]*regexp.Regexp, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		expr, err := regexp.Compile(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile regexp: %v", err)
+		}
+		expressions = append(expressions, expr)
+	}
+	return expressions, scanner.Err()
+}
+
+// splitList splits a comma-separated list, trims the entries and drops empty entries
+func splitList(s string) []string {
+	list := make([]string, 0)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// parseDurationOrByteCount parses either a duration like "2s" or a byte count like "10MB"
+func parseDurationOrByteCount(s string) (time.Duration, int64, error) {
+	duration, err := time.ParseDuration(s)
+	if err == nil {
+		return duration, 0, nil
+	}
+	bytes, err := internal.ParseByteCount(s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s is neither a duration nor a byte count", s)
+	}
+	return 0, bytes, nil
+}
+
+// clientTLSCertFile returns the tls-cert flag.
+// If the flag is not set and the default file does not exist, an empty string is returned,
+// so only the system certificates are trusted
+func clientTLSCertFile(c *cli.Context) string {
+	if !c.IsSet("tls-cert") {
+		_, err := os.Stat(defaultTLSCertificateFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			return ""
+		}
+	}
+	return c.String("tls-cert")
+}
+
+// openKeyLogFile returns nil if the keylog-file flag is not set
+func openKeyLogFile(c *cli.Context) (io.Writer, error) {
+	filename := c.String("keylog-file")
+	if filename == "" {
+		return nil, nil
+	}
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open keylog file: %w", err)
+	}
+	log.Warnf("writing TLS secrets to %s", filename)
+	return file, nil
+}
+
+// qlogConfigFromContext returns if qlog is enabled by the qlog or qlog-dir flag
+func qlogConfigFromContext(c *cli.Context) (bool, internal.QlogConfig, error) {
+	compression, err := internal.ParseQlogCompression(c.String("qlog-compression"))
+	if err != nil {
+		return false, internal.QlogConfig{}, err
+	}
+	config := internal.QlogConfig{
+		Dir:         c.String("qlog-dir"),
+		RunID:       c.String("run-id"),
+		Prefix:      c.String("qlog-prefix"),
+		Compression: compression,
+	}
+	if config.Dir != "" && config.RunID == "" {
+		config.RunID = time.Now().Format("20060102-150405")
+	}
+	return c.Bool("qlog") || config.Dir != "", config, nil
+}
+
+// clientTemplateFlags are the client flags of the experiment and bench commands,
+// including the transport parameter flags
+func clientTemplateFlags() []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{
+			Name:    "user-agent",
+			Aliases: []string{"U"},
+			Usage:   "Identification of client to the HTTP server",
+			Value:   defaultUserAgent,
+		},
+		&cli.StringFlag{
+			Name:  "accept-encoding",
+			Usage: "value of the Accept-Encoding request header",
+			Value: defaultAcceptEncoding,
+		},
+		&cli.BoolFlag{
+			Name:    "span-hosts",
+			Aliases: []string{"H"},
+			Usage:   "request page requisites on all hosts, not only on the hosts of the urls",
+			Value:   false,
+		},
+		&cli.UintFlag{
+			Name:  "parallel",
+			Usage: "number of parallel requests; for experiments, if not set in the spec",
+			Value: 10,
+		},
+		&cli.StringFlag{
+			Name:  "qlog-prefix",
+			Usage: "the prefix of the qlog file name",
+			Value: "client",
+		},
+		&cli.StringFlag{
+			Name:    "qlog-dir",
+			Usage:   "directory of the qlog files, enables qlog; the files of every run are written to <dir>/<run id>/<name of the run>",
+			EnvVars: []string{"QLOGDIR"},
+		},
+		&cli.StringFlag{
+			Name:  "qlog-compression",
+			Usage: "compress qlog files, \"gzip\" or \"zstd\"",
+		},
+		&cli.StringFlag{
+			Name:  "run-id",
+			Usage: "name of the qlog subdirectory; generated from the start time if not set",
+		},
+		&cli.StringFlag{
+			Name:    "keylog-file",
+			Usage:   "append TLS secrets in the NSS key log format to this file",
+			EnvVars: []string{"SSLKEYLOGFILE"},
+		},
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "timeout of a single request including the response body; 0 for no timeout",
+			Value: 0,
+		},
+		&cli.DurationFlag{
+			Name:  "run-timeout",
+			Usage: "timeout of every run; 0 for no timeout",
+			Value: 0,
+		},
+	}, transportParameterFlags()...)
+}
+
+// clientTemplateFromContext returns the client config of the clientTemplateFlags
+// and the keylog writer, that may be nil
+func clientTemplateFromContext(c *cli.Context) (client.Config, io.Writer, error) {
+	keyLogWriter, err := openKeyLogFile(c)
+	if err != nil {
+		return client.Config{}, nil, err
+	}
+	qlog, qlogConfig, err := qlogConfigFromContext(c)
+	if err != nil {
+		return client.Config{}, nil, err
+	}
+	transportParameters, err := transportParametersFromContext(c)
+	if err != nil {
+		return client.Config{}, nil, err
+	}
+	congestionControl, err := congestionControlFromContext(c)
+	if err != nil {
+		return client.Config{}, nil, err
+	}
+	return client.Config{
+		Qlog:                qlog,
+		QlogConfig:          qlogConfig,
+		KeyLogWriter:        keyLogWriter,
+		ParallelRequests:    c.Int("parallel"),
+		UserAgent:           c.String("user-agent"),
+		UrlBlacklist:        make([]*regexp.Regexp, 0),
+		UrlAllowlist:        make([]*regexp.Regexp, 0),
+		MaxDepth:            -1,
+		SpanHosts:           c.Bool("span-hosts"),
+		AcceptEncoding:      c.String("accept-encoding"),
+		MaxLinkDepth:        defaultMaxLinkDepth,
+		MaxPages:            defaultMaxPages,
+		RequestTimeout:      c.Duration("timeout"),
+		RunTimeout:          c.Duration("run-timeout"),
+		RetryBackoff:        defaultRetryBackoff,
+		SegmentConnections:  1,
+		ConnectionsPerHost:  1,
+		TransportParameters: transportParameters,
+		CongestionControl:   congestionControl,
+	}, keyLogWriter, nil
+}
+
+// transportParameterFlags are the QUIC transport parameter and congestion control flags of client and server
+func transportParameterFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "initial-stream-receive-window",
+			Usage: "initial stream-level flow control window, e.g. \"512KiB\"; default of quic-go if not set",
+		},
+		&cli.StringFlag{
+			Name:  "max-stream-receive-window",
+			Usage: "maximum stream-level flow control window, e.g. \"6MiB\"; default of quic-go if not set",
+		},
+		&cli.StringFlag{
+			Name:  "initial-connection-receive-window",
+			Usage: "initial connection-level flow control window, e.g. \"768KiB\"; default of quic-go if not set",
+		},
+		&cli.StringFlag{
+			Name:  "max-connection-receive-window",
+			Usage: "maximum connection-level flow control window, e.g. \"15MiB\"; default of quic-go if not set",
+		},
+		&cli.Int64Flag{
+			Name:  "max-incoming-streams",
+			Usage: "maximum number of concurrent bidirectional streams the peer may open; 0 for the default of quic-go, negative to allow none",
+			Value: 0,
+		},
+		&cli.Int64Flag{
+			Name:  "max-incoming-uni-streams",
+			Usage: "maximum number of concurrent unidirectional streams the peer may open; 0 for the default of quic-go, negative to allow none",
+			Value: 0,
+		},
+		&cli.DurationFlag{
+			Name:  "idle-timeout",
+			Usage: "maximum idle timeout of QUIC connections; 0 for the default of quic-go",
+			Value: 0,
+		},
+		&cli.DurationFlag{
+			Name:  "keep-alive",
+			Usage: "period of keep-alive packets; 0 for no keep-alive packets",
+			Value: 0,
+		},
+		&cli.DurationFlag{
+			Name:  "handshake-timeout",
+			Usage: "idle timeout before the QUIC handshake is completed; 0 for the default of quic-go",
+			Value: 0,
+		},
+		&cli.BoolFlag{
+			Name:  "datagrams",
+			Usage: "enable the QUIC datagram extension",
+			Value: false,
+		},
+		&cli.StringFlag{
+			Name:  "congestion-control",
+			Usage: "congestion control algorithm: reno, hybla-westwood, fixed-window or fixed-rate; fixed-window keeps the congestion window constant as a baseline, the sending rate still varies with the RTT; fixed-rate paces the packets to every peer address at --pacing-rate, connections can not be migrated",
+			Value: internal.CONGESTION_CONTROL_RENO,
+		},
+		&cli.UintFlag{
+			Name:  "congestion-window",
+			Usage: "congestion window of the fixed-window congestion control, in packets; 0 for the default initial congestion window of quic-go",
+			Value: 0,
+		},
+		&cli.Float64Flag{
+			Name:  "pacing-rate",
+			Usage: "sending rate of the fixed-rate congestion control to every peer address, in Mbit/s",
+			Value: 0,
+		},
+	}
+}
+
+// congestionControlFromContext reads the congestion control flags of transportParameterFlags
+func congestionControlFromContext(c *cli.Context) (internal.CongestionControl, error) {
+	return internal.ParseCongestionControl(c.String("congestion-control"), uint32(c.Uint("congestion-window")), c.Float64("pacing-rate"))
+}
+
+// transportParametersFromContext reads the flags of transportParameterFlags
+func transportParametersFromContext(c *cli.Context) (internal.TransportParameters, error) {
+	params := internal.TransportParameters{
+		MaxIncomingStreams:    c.Int64("max-incoming-streams"),
+		MaxIncomingUniStreams: c.Int64("max-incoming-uni-streams"),
+		MaxIdleTimeout:        c.Duration("idle-timeout"),
+		KeepAlivePeriod:       c.Duration("keep-alive"),
+		HandshakeIdleTimeout:  c.Duration("handshake-timeout"),
+		EnableDatagrams:       c.Bool("datagrams"),
+	}
+	windows := []struct {
+		flag  string
+		value *uint64
+	}{
+		{"initial-stream-receive-window", &params.InitialStreamReceiveWindow},
+		{"max-stream-receive-window", &params.MaxStreamReceiveWindow},
+		{"initial-connection-receive-window", &params.InitialConnectionReceiveWindow},
+		{"max-connection-receive-window", &params.MaxConnectionReceiveWindow},
+	}
+	for _, window := range windows {
+		if !c.IsSet(window.flag) {
+			continue
+		}
+		bytes, err := internal.ParseByteCount(c.String(window.flag))
+		if err != nil {
+			return params, fmt.Errorf("invalid --%s: %v", window.flag, err)
+		}
+		*window.value = uint64(bytes)
+	}
+	return params, nil
+}
@@ -0,0 +1,193 @@
+package relay
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"sync"
+	"time"
+)
+
+// sessions without packets from the client are removed after this time
+const sessionIdleTimeout = time.Minute
+
+const maxPacketSize = 65535
+
+// Config of the rebind relay.
+// The relay forwards UDP packets between clients and the server,
+// and changes the source port of the forwarded client traffic at the configured times,
+// like a NAT rebinding.
+type Config struct {
+	// address to listen on for client packets
+	Addr string
+	// address of the server
+	ServerAddr string
+	// times after the first packet of a client, when the source port is changed.
+	// QUIC servers do not accept a new path before the handshake is confirmed,
+	// so rebinding during the handshake may break the connection
+	RebindAt []time.Duration
+	// change the source port periodically.
+	// 0 means no periodic rebinding
+	RebindInterval time.Duration
+}
+
+type relay struct {
+	config     *Config
+	conn       *net.UDPConn
+	serverAddr *net.UDPAddr
+	mutex      sync.Mutex
+	sessions   map[string]*session
+}
+
+// session forwards the packets of one client address
+type session struct {
+	relay      *relay
+	clientAddr *net.UDPAddr
+	mutex      sync.Mutex
+	// socket towards the server; replaced on rebind
+	upstream  *net.UDPConn
+	idleTimer *time.Timer
+	timers    []*time.Timer
+	closed    bool
+}
+
+// Run blocks until the listener fails
+func Run(config Config) error {
+	addr, err := net.ResolveUDPAddr("udp", config.Addr)
+	if err != nil {
+		return err
+	}
+	serverAddr, err := net.ResolveUDPAddr("udp", config.ServerAddr)
+	if err != nil {
+		return fmt.Errorf("failed to resolve server address: %w", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	log.Infof("relay %s to %s", conn.LocalAddr(), serverAddr)
+	return serve(conn, serverAddr, &config)
+}
+
+// serve forwards the client packets received on conn, until conn is closed
+func serve(conn *net.UDPConn, serverAddr *net.UDPAddr, config *Config) error {
+	r := &relay{
+		config:     config,
+		conn:       conn,
+		serverAddr: serverAddr,
+		sessions:   make(map[string]*session),
+	}
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, clientAddr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return err
+		}
+		s, err := r.session(clientAddr)
+		if err != nil {
+			log.Errorf("failed to open session for %s: %v", clientAddr, err)
+			continue
+		}
+		s.forward(buf[:n])
+	}
+}
+
+// session returns the session of the client address, a new session is started for unknown addresses
+func (r *relay) session(clientAddr *net.UDPAddr) (*session, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if s, ok := r.sessions[clientAddr.String()]; ok {
+		return s, nil
+	}
+	upstream, err := net.DialUDP("udp", nil, r.serverAddr)
+	if err != nil {
+		return nil, err
+	}
+	s := &session{
+		relay:      r,
+		clientAddr: clientAddr,
+		upstream:   upstream,
+	}
+	s.idleTimer = time.AfterFunc(sessionIdleTimeout, s.close)
+	for _, at := range r.config.RebindAt {
+		s.timers = append(s.timers, time.AfterFunc(at, s.rebind))
+	}
+	if r.config.RebindInterval > 0 {
+		var next func()
+		next = func() {
+			s.rebind()
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			if !s.closed {
+				s.timers = append(s.timers, time.AfterFunc(r.config.RebindInterval, next))
+			}
+		}
+		s.timers = append(s.timers, time.AfterFunc(r.config.RebindInterval, next))
+	}
+	r.sessions[clientAddr.String()] = s
+	go s.receive(upstream)
+	log.Infof("started session of %s via %s", clientAddr, upstream.LocalAddr())
+	return s, nil
+}
+
+// forward sends the client packet to the server
+func (s *session) forward(packet []byte) {
+	s.idleTimer.Reset(sessionIdleTimeout)
+	s.mutex.Lock()
+	upstream := s.upstream
+	s.mutex.Unlock()
+	_, err := upstream.Write(packet)
+	if err != nil {
+		log.Debugf("failed to forward packet of %s: %v", s.clientAddr, err)
+	}
+}
+
+// receive sends the server packets received on upstream to the client, until upstream is closed
+func (s *session) receive(upstream *net.UDPConn) {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, err := upstream.Read(buf)
+		if err != nil {
+			return
+		}
+		_, err = s.relay.conn.WriteToUDP(buf[:n], s.clientAddr)
+		if err != nil {
+			log.Debugf("failed to forward packet to %s: %v", s.clientAddr, err)
+		}
+	}
+}
+
+// rebind replaces the socket towards the server, so the server observes a new source port.
+// Packets sent by the server to the old port are dropped, like after a NAT rebinding.
+func (s *session) rebind() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	upstream, err := net.DialUDP("udp", nil, s.relay.serverAddr)
+	if err != nil {
+		log.Errorf("failed to rebind session of %s: %v", s.clientAddr, err)
+		return
+	}
+	old := s.upstream
+	s.upstream = upstream
+	old.Close()
+	go s.receive(upstream)
+	log.Infof("rebound session of %s from %s to %s", s.clientAddr, old.LocalAddr(), upstream.LocalAddr())
+}
+
+func (s *session) close() {
+	s.relay.mutex.Lock()
+	delete(s.relay.sessions, s.clientAddr.String())
+	s.relay.mutex.Unlock()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	for _, timer := range s.timers {
+		timer.Stop()
+	}
+	s.upstream.Close()
+	log.Infof("closed idle session of %s", s.clientAddr)
+}
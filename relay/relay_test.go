@@ -0,0 +1,67 @@
+package relay
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// listenLoopback returns a UDP socket on an ephemeral loopback port
+func listenLoopback(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestRebind(t *testing.T) {
+	server := listenLoopback(t)
+	relayConn := listenLoopback(t)
+	go serve(relayConn, server.LocalAddr().(*net.UDPAddr), &Config{RebindAt: []time.Duration{200 * time.Millisecond}})
+	client := listenLoopback(t)
+
+	// roundTrip sends a packet through the relay, answers it by the server and returns the source address observed by the server
+	buf := make([]byte, maxPacketSize)
+	roundTrip := func(payload string) *net.UDPAddr {
+		_, err := client.WriteToUDP([]byte(payload), relayConn.LocalAddr().(*net.UDPAddr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.SetReadDeadline(time.Now().Add(time.Second))
+		n, source, err := server.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("server did not receive %s: %v", payload, err)
+		}
+		if string(buf[:n]) != payload {
+			t.Errorf("expected %s, got %s", payload, buf[:n])
+		}
+		_, err = server.WriteToUDP(buf[:n], source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err = client.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("client did not receive the answer to %s: %v", payload, err)
+		}
+		if string(buf[:n]) != payload {
+			t.Errorf("expected answer %s, got %s", payload, buf[:n])
+		}
+		return source
+	}
+
+	first := roundTrip("first")
+	if second := roundTrip("second"); second.String() != first.String() {
+		t.Errorf("source changed before the rebind, from %s to %s", first, second)
+	}
+	time.Sleep(300 * time.Millisecond)
+	rebound := roundTrip("rebound")
+	if rebound.Port == first.Port {
+		t.Errorf("expected a new source port after the rebind, got %s", rebound)
+	}
+	if again := roundTrip("again"); again.String() != rebound.String() {
+		t.Errorf("source changed without rebind, from %s to %s", rebound, again)
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"http-perf-go/internal"
+	"io/fs"
+	"net"
+	"os"
+	"time"
+)
+
+// the key of the ephemeral certificate only exists in memory,
+// so the certificate is useless after the server stopped, regardless of its validity
+const ephemeralCertificateValidity = 365 * 24 * time.Hour
+
+// loadCertificate loads the certificate and key files.
+// If neither exists, an ephemeral self-signed certificate for localhost, the listen address
+// and the multi-domain hostnames is generated.
+// The ephemeral certificate is written to a temporary file, so that clients can trust it;
+// its filename is returned and must be removed by the caller when the server stops
+func loadCertificate(config *Config, addr *net.UDPAddr) (tls.Certificate, string, error) {
+	if exists(config.TlsCertFile) || exists(config.TlsKeyFile) {
+		cert, err := tls.LoadX509KeyPair(config.TlsCertFile, config.TlsKeyFile)
+		return cert, "", err
+	}
+	hostnames := []string{"localhost"}
+	if config.MultiDomain {
+		domains, err := internal.ListHostnameDirectories(config.ServeDir)
+		if err != nil {
+			return tls.Certificate{}, "", err
+		}
+		hostnames = append(hostnames, domains...)
+	}
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	if !addr.IP.IsUnspecified() && !addr.IP.IsLoopback() {
+		ips = append(ips, addr.IP)
+	}
+	cert, err := internal.GenerateCertificate(internal.CertificateConfig{
+		CommonName: "localhost",
+		Hostnames:  hostnames,
+		IPs:        ips,
+		Validity:   ephemeralCertificateValidity,
+	}, nil)
+	if err != nil {
+		return tls.Certificate{}, "", fmt.Errorf("failed to generate ephemeral certificate: %w", err)
+	}
+	certFile, err := writeEphemeralCertificate(cert)
+	if err != nil {
+		return tls.Certificate{}, "", fmt.Errorf("failed to write ephemeral certificate: %w", err)
+	}
+	log.Warnf("%s not found, using an ephemeral self-signed certificate with SHA-256 fingerprint %x; trust it with --tls-cert %s while the server runs, or create a trusted certificate with the certgen command", config.TlsCertFile, sha256.Sum256(cert.Cert.Raw), certFile)
+	return cert.TLSCertificate(), certFile, nil
+}
+
+// writeEphemeralCertificate writes the PEM encoded certificate, without key, to a temporary file
+func writeEphemeralCertificate(cert *internal.Certificate) (string, error) {
+	f, err := os.CreateTemp("", "http-perf-go-ephemeral-*.crt")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	err = pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Cert.Raw})
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+func exists(filename string) bool {
+	_, err := os.Stat(filename)
+	return !errors.Is(err, fs.ErrNotExist)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"http-perf-go/internal"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadCertificate(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "example.com"), 0755)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config := &Config{
+		TlsCertFile: filepath.Join(dir, "server.crt"),
+		TlsKeyFile:  filepath.Join(dir, "server.key"),
+		ServeDir:    dir,
+		MultiDomain: true,
+	}
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 443}
+
+	// ephemeral certificate, trusted by its temporary file
+	cert, certFile, err := loadCertificate(config, addr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.Remove(certFile)
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		t.Fatalf("expected PEM encoded certificate in %s", certFile)
+	}
+	trusted, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(trusted)
+	for _, name := range []string{"localhost", "example.com", "127.0.0.1", "::1", "192.0.2.1"} {
+		_, err = cert.Leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: roots})
+		if err != nil {
+			t.Errorf("expected valid certificate for %s: %v", name, err)
+		}
+	}
+
+	// existing files
+	generated, err := internal.GenerateCertificate(internal.CertificateConfig{CommonName: "localhost", Hostnames: []string{"localhost"}, Validity: time.Hour}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = generated.WriteFiles(config.TlsCertFile, config.TlsKeyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cert, certFile, err = loadCertificate(config, addr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if certFile != "" {
+		t.Errorf("expected no ephemeral certificate file, got %s", certFile)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil || !leaf.Equal(generated.Cert) {
+		t.Errorf("expected the certificate of the files")
+	}
+
+	// a missing key is not replaced by an ephemeral certificate
+	err = os.Remove(config.TlsKeyFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, _, err = loadCertificate(config, addr)
+	if err == nil {
+		t.Errorf("expected error for missing key file")
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"github.com/lucas-clemente/quic-go/logging"
+	"http-perf-go/internal"
+	"net/http"
+	"time"
+)
+
+const metricsPrefix = "http_perf_server"
+
+// serverMetrics are served by the metrics endpoint
+type serverMetrics struct {
+	registry        internal.MetricsRegistry
+	requests        *internal.Counter
+	sentBytes       *internal.Counter
+	sentPackets     *internal.Counter
+	requestDuration *internal.Histogram
+	connections     *internal.ConnectionMetrics
+}
+
+func newServerMetrics(registry internal.MetricsRegistry) *serverMetrics {
+	return &serverMetrics{
+		registry:        registry,
+		requests:        registry.Counter(metricsPrefix+"_requests", "HTTP requests"),
+		sentBytes:       registry.Counter(metricsPrefix+"_sent_bytes", "bytes of sent QUIC packets"),
+		sentPackets:     registry.Counter(metricsPrefix+"_sent_packets", "sent QUIC packets"),
+		requestDuration: registry.Histogram(metricsPrefix+"_request_duration_seconds", "duration from receiving a request until the response is written", internal.DefaultDurationBuckets),
+		connections:     internal.NewConnectionMetrics(registry, metricsPrefix),
+	}
+}
+
+func (m *serverMetrics) error(category string) {
+	m.registry.Counter(metricsPrefix+"_errors", "errors by category", "category", category).Inc()
+}
+
+func (m *serverMetrics) closedConnection(odcid logging.ConnectionID, err error) {
+	m.connections.ClosedConnection(odcid)
+	if category := connectionErrorCategory(err); category != "" {
+		m.error(category)
+	}
+}
+
+func (m *serverMetrics) sentPacket(odcid logging.ConnectionID, size logging.ByteCount) {
+	m.sentBytes.Add(float64(size))
+	m.sentPackets.Inc()
+}
+
+// handler counts the requests and the HTTP errors
+func (m *serverMetrics) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		m.requests.Inc()
+		sw := &statusWriter{ResponseWriter: writer, status: http.StatusOK}
+		next.ServeHTTP(sw, request)
+		m.requestDuration.Observe(time.Since(start).Seconds())
+		switch {
+		case sw.status >= 400 && sw.status < 500:
+			m.error("http 4xx")
+		case sw.status >= 500:
+			m.error("http 5xx")
+		}
+	})
+}
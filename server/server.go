@@ -1,14 +1,17 @@
 package server
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/logging"
 	log "github.com/sirupsen/logrus"
 	"http-perf-go/internal"
+	"io"
 	"net"
 	"net/http"
+	"os"
 	"strings"
 )
 import "github.com/lucas-clemente/quic-go/http3"
@@ -16,19 +19,52 @@ import "github.com/lucas-clemente/quic-go/http3"
 // TODO chromium based browsers
 // TODO HTTP/1
 type Config struct {
+	// if neither file exists, an ephemeral self-signed certificate is generated
 	TlsCertFile string
 	TlsKeyFile  string
 	ServeDir    string
 	Addr        string
 	Qlog        bool
-	QlogPrefix  string
+	QlogConfig  internal.QlogConfig
 	MultiDomain bool
 	// serve files with query strings in its filenames.
 	// e.g. wget does put them in the filename
 	QueryStringInFilename bool
+	// content encodings to compress responses on the fly, in order of preference
+	Compression []string
+	// serve precompressed files, e.g. index.html.gz
+	Precompressed bool
+	// Cache-Control headers by path pattern
+	CacheControl []internal.CacheControlPolicy
+	// set strong ETags derived from the file content
+	ETags bool
+	// zero values select the quic-go defaults
+	TransportParameters internal.TransportParameters
+	CongestionControl   internal.CongestionControl
+	// address of the admin HTTP endpoint serving statistics as JSON.
+	// if empty, the admin endpoint is disabled
+	AdminAddr string
+	// address of the HTTP endpoint serving OpenMetrics at /metrics.
+	// if empty, the metrics endpoint is disabled
+	MetricsAddr string
+	// TLS secrets are written to it in the NSS key log format, to decrypt packet captures.
+	// may be nil
+	KeyLogWriter io.Writer
+	// write all sent and received UDP datagrams to this pcapng file.
+	// if empty, no packets are captured
+	PcapFile string
+	// called with the address the server listens on, e.g. to get the port if Addr has port 0.
+	// may be nil
+	OnListen func(addr *net.UDPAddr)
 }
 
 func Run(config Config) error {
+	return RunContext(context.Background(), config)
+}
+
+// RunContext blocks until the server fails or the context is done.
+// If the context is done, the servers are closed and nil is returned
+func RunContext(ctx context.Context, config Config) error {
 	// Open the listeners
 	udpAddr, err := net.ResolveUDPAddr("udp", config.Addr)
 	if err != nil {
@@ -39,12 +75,23 @@ func Run(config Config) error {
 		return err
 	}
 	defer udpConn.Close()
+	// the TCP listener uses the same port, also if an ephemeral port is requested
+	udpAddr = udpConn.LocalAddr().(*net.UDPAddr)
 
-	tcpAddr, err := net.ResolveTCPAddr("tcp", config.Addr)
-	if err != nil {
-		return err
+	var packetConn net.PacketConn = udpConn
+	if config.PcapFile != "" {
+		pcap, err := internal.CreatePcapFile(config.PcapFile)
+		if err != nil {
+			return fmt.Errorf("failed to create pcap file: %w", err)
+		}
+		defer pcap.Close()
+		log.Infof("created pcap file: %s", config.PcapFile)
+		packetConn = internal.NewCapturingPacketConn(udpConn, pcap)
 	}
-	tcpConn, err := net.ListenTCP("tcp", tcpAddr)
+	// paced after the capture, so the capture has the send times
+	packetConn = config.CongestionControl.WrapPacketConn(packetConn)
+
+	tcpConn, err := net.ListenTCP("tcp", &net.TCPAddr{IP: udpAddr.IP, Port: udpAddr.Port, Zone: udpAddr.Zone})
 	if err != nil {
 		return err
 	}
@@ -52,34 +99,64 @@ func Run(config Config) error {
 
 	log.Infof("listening on %s, serving %s", udpAddr, config.ServeDir)
 
-	tlsCert, err := tls.LoadX509KeyPair(config.TlsCertFile, config.TlsKeyFile)
+	tlsCert, ephemeralCertFile, err := loadCertificate(&config, udpAddr)
 	if err != nil {
 		return err
 	}
+	if ephemeralCertFile != "" {
+		defer os.Remove(ephemeralCertFile)
+	}
 
 	tlsConf := &tls.Config{
 		Certificates: []tls.Certificate{tlsCert},
+		KeyLogWriter: config.KeyLogWriter,
 	}
 
 	tlsConn := tls.NewListener(tcpConn, tlsConf)
 	defer tlsConn.Close()
 
+	var stats *serverStats
+	if config.AdminAddr != "" {
+		stats = newServerStats()
+	}
+	var metrics *serverMetrics
+	if config.MetricsAddr != "" {
+		metrics = newServerMetrics(internal.NewMetricsRegistry())
+	}
+
 	tracers := make([]logging.Tracer, 0)
 
-	tracers = append(tracers, internal.NewEventTracer(internal.Handlers{
+	handlers := internal.Handlers{
 		UpdatePath: func(odcid logging.ConnectionID, newRemote net.Addr) {
-			log.Infof("migrated QUIC connection %s to %s", odcid.String(), newRemote)
+			log.WithFields(log.Fields{"odcid": odcid.String(), "remote": newRemote.String()}).Infof("migrated QUIC connection %s to %s", odcid.String(), newRemote)
+			if metrics != nil {
+				metrics.connections.Migrated()
+			}
 		},
 		StartedConnection: func(odcid logging.ConnectionID, local, remote net.Addr, srcConnID, destConnID logging.ConnectionID) {
-			log.Infof("started QUIC connection %s", odcid.String())
+			log.WithFields(log.Fields{"odcid": odcid.String(), "remote": remote.String(), "congestion_control": config.CongestionControl.String()}).Infof("started QUIC connection %s, congestion control: %s", odcid.String(), config.CongestionControl)
+			if metrics != nil {
+				metrics.connections.StartedConnection(odcid)
+			}
 		},
 		ClosedConnection: func(odcid logging.ConnectionID, err error) {
-			log.Infof("closed QUIC connection %s", odcid.String())
+			log.WithField("odcid", odcid.String()).Infof("closed QUIC connection %s", odcid.String())
+			if metrics != nil {
+				metrics.closedConnection(odcid, err)
+			}
 		},
-	}))
+	}
+	if metrics != nil {
+		handlers.SentPacket = metrics.sentPacket
+		handlers.HandshakeConfirmed = metrics.connections.HandshakeConfirmed
+	}
+	tracers = append(tracers, internal.NewEventTracer(handlers))
+	if stats != nil {
+		tracers = append(tracers, stats.tracer())
+	}
 
 	if config.Qlog {
-		tracers = append(tracers, internal.NewQlogTracer(config.QlogPrefix, func(filename string) {
+		tracers = append(tracers, internal.NewQlogTracer(config.QlogConfig, func(filename string) {
 			log.Infof("created qlog file: %s", filename)
 		}))
 	}
@@ -89,9 +166,16 @@ func Run(config Config) error {
 		EnableActiveMigration: true,
 		ExtraStreamEncryption: quic.PreferExtraStreamEncryption,
 	}
+	config.TransportParameters.Apply(quicConf)
+	config.CongestionControl.Apply(quicConf)
+	log.Infof("quic transport parameters: %s", config.TransportParameters.Effective())
 
 	fileServerConfig := internal.FileServerConfig{
 		QueryStringAsPartOfFile: config.QueryStringInFilename,
+		Compression:             config.Compression,
+		Precompressed:           config.Precompressed,
+		CacheControl:            config.CacheControl,
+		ETags:                   config.ETags,
 	}
 
 	var handler http.Handler
@@ -104,13 +188,20 @@ func Run(config Config) error {
 	} else {
 		handler = internal.NewFileServer(http.Dir(config.ServeDir), fileServerConfig)
 	}
+	if stats != nil {
+		handler = stats.handler(handler)
+	}
+	if metrics != nil {
+		handler = metrics.handler(handler)
+	}
 
 	// HTTP/3 server
 	quicServer := http3.Server{
-		Handler:    handler,
-		Addr:       config.Addr,
-		QuicConfig: quicConf,
-		TLSConfig:  tlsConf,
+		Handler:         handler,
+		Addr:            config.Addr,
+		QuicConfig:      quicConf,
+		TLSConfig:       tlsConf,
+		EnableDatagrams: config.TransportParameters.EnableDatagrams,
 	}
 
 	// HTTP/1.1 server
@@ -121,21 +212,51 @@ func Run(config Config) error {
 		}),
 	}
 
-	tErr := make(chan error)
-	qErr := make(chan error)
+	// the endpoints are closed on every return, also if the HTTP/3 or HTTP/1.1 server fails
+	var aErr, mErr <-chan error
+	if stats != nil {
+		adminServer, err := stats.startAdmin(config.AdminAddr)
+		if err != nil {
+			return fmt.Errorf("failed to start admin endpoint: %w", err)
+		}
+		defer adminServer.Close()
+		aErr = adminServer.Errors
+	}
+	if metrics != nil {
+		metricsServer, err := internal.StartMetricsServer(config.MetricsAddr, metrics.registry)
+		if err != nil {
+			return fmt.Errorf("failed to start metrics endpoint: %w", err)
+		}
+		defer metricsServer.Close()
+		mErr = metricsServer.Errors
+	}
+
+	// buffered, so that the goroutine of the server that did not fail can return
+	tErr := make(chan error, 1)
+	qErr := make(chan error, 1)
 	go func() {
 		tErr <- tcpServer.Serve(tlsConn)
 	}()
 	go func() {
-		qErr <- quicServer.Serve(udpConn)
+		qErr <- quicServer.Serve(packetConn)
 	}()
+	defer quicServer.Close()
+	defer tcpServer.Close()
+
+	if config.OnListen != nil {
+		config.OnListen(udpAddr)
+	}
 
 	select {
+	case <-ctx.Done():
+		return nil
 	case err := <-tErr:
-		quicServer.Close()
 		return err
 	case err := <-qErr:
-		tcpServer.Close()
 		return err
+	case err := <-aErr:
+		return fmt.Errorf("admin endpoint failed: %w", err)
+	case err := <-mErr:
+		return fmt.Errorf("metrics endpoint failed: %w", err)
 	}
 }
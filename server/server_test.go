@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunContextClosesEndpoints(t *testing.T) {
+	dir := t.TempDir()
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	adminAddr := occupied.Addr().String()
+	config := Config{
+		Addr:        "127.0.0.1:0",
+		ServeDir:    dir,
+		TlsCertFile: filepath.Join(dir, "server.crt"),
+		TlsKeyFile:  filepath.Join(dir, "server.key"),
+		AdminAddr:   adminAddr,
+	}
+	err = RunContext(context.Background(), config)
+	if err == nil {
+		t.Errorf("expected bind error of the admin endpoint")
+	}
+	occupied.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	config.OnListen = func(addr *net.UDPAddr) {
+		cancel()
+	}
+	err = RunContext(ctx, config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	listener, err := net.Listen("tcp", adminAddr)
+	if err != nil {
+		t.Fatalf("expected closed admin endpoint: %v", err)
+	}
+	listener.Close()
+}
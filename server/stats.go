@@ -0,0 +1,320 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/logging"
+	log "github.com/sirupsen/logrus"
+	"http-perf-go/internal"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HTTP/3 error code of connections closed without error
+const h3NoError = 0x100
+
+// serverStats collects the connection and request statistics served by the admin endpoint.
+// The mutex is only taken when a connection starts, migrates or closes, and per request;
+// the per-packet counters of a connection are atomic and updated without lookup by the connection tracer
+type serverStats struct {
+	mutex sync.Mutex
+	// open connections, by ODCID
+	connections map[string]*connectionStats
+	// by remote address, to assign requests to connections
+	connectionsByRemote map[string]*connectionStats
+	closedConnections   int64
+	requestsPerHost     map[string]int64
+	errors              map[string]int64
+}
+
+type connectionStats struct {
+	odcid     string
+	startedAt time.Time
+	// guarded by serverStats.mutex
+	remoteAddr  string
+	bytesSent   atomic.Int64
+	packetsSent atomic.Int64
+	// requests currently served on this connection
+	activeStreams atomic.Int64
+	requests      atomic.Int64
+	// guards the recovery metrics
+	metricsMutex     sync.Mutex
+	smoothedRTT      time.Duration
+	latestRTT        time.Duration
+	minRTT           time.Duration
+	congestionWindow int64
+	bytesInFlight    int64
+}
+
+type connectionSnapshot struct {
+	ODCID      string    `json:"odcid"`
+	RemoteAddr string    `json:"remote_addr"`
+	StartedAt  time.Time `json:"started_at"`
+	// milliseconds
+	SmoothedRTT      float64 `json:"smoothed_rtt_ms"`
+	LatestRTT        float64 `json:"latest_rtt_ms"`
+	MinRTT           float64 `json:"min_rtt_ms"`
+	CongestionWindow int64   `json:"congestion_window"`
+	BytesInFlight    int64   `json:"bytes_in_flight"`
+	BytesSent        int64   `json:"bytes_sent"`
+	PacketsSent      int64   `json:"packets_sent"`
+	// requests currently served on this connection
+	ActiveStreams int64 `json:"active_streams"`
+	Requests      int64 `json:"requests"`
+}
+
+type statsSnapshot struct {
+	Connections       []connectionSnapshot `json:"connections"`
+	ClosedConnections int64                `json:"closed_connections"`
+	RequestsPerHost   map[string]int64     `json:"requests_per_host"`
+	Errors            map[string]int64     `json:"errors"`
+}
+
+func newServerStats() *serverStats {
+	return &serverStats{
+		connections:         make(map[string]*connectionStats),
+		connectionsByRemote: make(map[string]*connectionStats),
+		requestsPerHost:     make(map[string]int64),
+		errors:              make(map[string]int64),
+	}
+}
+
+// tracer records the connections and their packets
+func (s *serverStats) tracer() logging.Tracer {
+	return statsTracer{stats: s}
+}
+
+type statsTracer struct {
+	logging.NullTracer
+	stats *serverStats
+}
+
+// TracerForConnection resolves the statistics of the connection once,
+// the connection is listed when it is started
+func (t statsTracer) TracerForConnection(ctx context.Context, p logging.Perspective, odcid logging.ConnectionID) logging.ConnectionTracer {
+	return &statsConnectionTracer{stats: t.stats, connection: &connectionStats{odcid: odcid.String()}}
+}
+
+type statsConnectionTracer struct {
+	logging.NullConnectionTracer
+	stats      *serverStats
+	connection *connectionStats
+}
+
+func (t *statsConnectionTracer) StartedConnection(local, remote net.Addr, srcConnID, destConnID logging.ConnectionID) {
+	t.stats.startedConnection(t.connection, remote)
+}
+
+func (t *statsConnectionTracer) UpdatedPath(newRemote net.Addr) {
+	t.stats.updatedPath(t.connection, newRemote)
+}
+
+func (t *statsConnectionTracer) ClosedConnection(err error) {
+	t.stats.closedConnection(t.connection, err)
+}
+
+func (t *statsConnectionTracer) SentPacket(hdr *logging.ExtendedHeader, size logging.ByteCount, ack *logging.AckFrame, frames []logging.Frame) {
+	t.connection.bytesSent.Add(int64(size))
+	t.connection.packetsSent.Add(1)
+}
+
+func (t *statsConnectionTracer) UpdatedMetrics(rttStats *logging.RTTStats, cwnd, bytesInFlight logging.ByteCount, packetsInFlight int) {
+	c := t.connection
+	c.metricsMutex.Lock()
+	defer c.metricsMutex.Unlock()
+	c.smoothedRTT = rttStats.SmoothedRTT()
+	c.latestRTT = rttStats.LatestRTT()
+	c.minRTT = rttStats.MinRTT()
+	c.congestionWindow = int64(cwnd)
+	c.bytesInFlight = int64(bytesInFlight)
+}
+
+func (s *serverStats) startedConnection(c *connectionStats, remote net.Addr) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	c.remoteAddr = remote.String()
+	c.startedAt = time.Now()
+	s.connections[c.odcid] = c
+	s.connectionsByRemote[c.remoteAddr] = c
+}
+
+func (s *serverStats) updatedPath(c *connectionStats, newRemote net.Addr) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.connections[c.odcid] != c {
+		return
+	}
+	delete(s.connectionsByRemote, c.remoteAddr)
+	c.remoteAddr = newRemote.String()
+	s.connectionsByRemote[c.remoteAddr] = c
+}
+
+func (s *serverStats) closedConnection(c *connectionStats, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.connections[c.odcid] == c {
+		// another connection may use the remote address by now
+		if s.connectionsByRemote[c.remoteAddr] == c {
+			delete(s.connectionsByRemote, c.remoteAddr)
+		}
+		delete(s.connections, c.odcid)
+		s.closedConnections++
+	}
+	if category := connectionErrorCategory(err); category != "" {
+		s.errors[category]++
+	}
+}
+
+// handler counts the requests per hostname and connection, and the HTTP errors
+func (s *serverStats) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		host, _, err := net.SplitHostPort(request.Host)
+		if err != nil {
+			host = request.Host
+		}
+		s.mutex.Lock()
+		s.requestsPerHost[host]++
+		c := s.connectionsByRemote[request.RemoteAddr]
+		s.mutex.Unlock()
+		if c != nil {
+			c.requests.Add(1)
+			c.activeStreams.Add(1)
+		}
+
+		sw := &statusWriter{ResponseWriter: writer, status: http.StatusOK}
+		next.ServeHTTP(sw, request)
+
+		if c != nil {
+			c.activeStreams.Add(-1)
+		}
+		var category string
+		switch {
+		case sw.status >= 400 && sw.status < 500:
+			category = "http 4xx"
+		case sw.status >= 500:
+			category = "http 5xx"
+		default:
+			return
+		}
+		s.mutex.Lock()
+		s.errors[category]++
+		s.mutex.Unlock()
+	})
+}
+
+func (s *serverStats) snapshot() statsSnapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := statsSnapshot{
+		Connections:       make([]connectionSnapshot, 0),
+		ClosedConnections: s.closedConnections,
+		RequestsPerHost:   make(map[string]int64, len(s.requestsPerHost)),
+		Errors:            make(map[string]int64, len(s.errors)),
+	}
+	for _, c := range s.connections {
+		snapshot.Connections = append(snapshot.Connections, c.snapshot())
+	}
+	sort.Slice(snapshot.Connections, func(i, j int) bool {
+		return snapshot.Connections[i].StartedAt.Before(snapshot.Connections[j].StartedAt)
+	})
+	for host, count := range s.requestsPerHost {
+		snapshot.RequestsPerHost[host] = count
+	}
+	for category, count := range s.errors {
+		snapshot.Errors[category] = count
+	}
+	return snapshot
+}
+
+// snapshot must be called with serverStats.mutex held, which guards the remote address
+func (c *connectionStats) snapshot() connectionSnapshot {
+	c.metricsMutex.Lock()
+	defer c.metricsMutex.Unlock()
+	return connectionSnapshot{
+		ODCID:            c.odcid,
+		RemoteAddr:       c.remoteAddr,
+		StartedAt:        c.startedAt,
+		SmoothedRTT:      milliseconds(c.smoothedRTT),
+		LatestRTT:        milliseconds(c.latestRTT),
+		MinRTT:           milliseconds(c.minRTT),
+		CongestionWindow: c.congestionWindow,
+		BytesInFlight:    c.bytesInFlight,
+		BytesSent:        c.bytesSent.Load(),
+		PacketsSent:      c.packetsSent.Load(),
+		ActiveStreams:    c.activeStreams.Load(),
+		Requests:         c.requests.Load(),
+	}
+}
+
+// ServeHTTP serves the statistics as JSON
+func (s *serverStats) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(s.snapshot())
+	if err != nil {
+		log.Errorf("failed to write stats: %v", err)
+	}
+}
+
+// startAdmin serves the statistics on addr at /stats in the background, until the server is closed
+func (s *serverStats) startAdmin(addr string) (*internal.HTTPServer, error) {
+	mux := http.NewServeMux()
+	mux.Handle("/stats", s)
+	server, err := internal.StartHTTPServer(&http.Server{Addr: addr, Handler: mux})
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("admin endpoint on http://%s/stats", addr)
+	return server, nil
+}
+
+// connectionErrorCategory returns an empty string for connections closed without error
+func connectionErrorCategory(err error) string {
+	var applicationErr *quic.ApplicationError
+	var idleTimeoutErr *quic.IdleTimeoutError
+	var handshakeTimeoutErr *quic.HandshakeTimeoutError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &applicationErr) && (applicationErr.ErrorCode == 0 || applicationErr.ErrorCode == h3NoError):
+		return ""
+	case errors.As(err, &idleTimeoutErr):
+		return "idle timeout"
+	case errors.As(err, &handshakeTimeoutErr):
+		return "handshake timeout"
+	default:
+		return "connection error"
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// statusWriter records the status code of the response
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.status = statusCode
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
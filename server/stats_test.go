@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/logging"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// startConnection starts a connection on the tracer of the statistics
+func startConnection(stats *serverStats, odcid quic.ConnectionID, remote net.Addr) logging.ConnectionTracer {
+	tracer := stats.tracer().TracerForConnection(context.Background(), logging.PerspectiveServer, odcid)
+	tracer.StartedConnection(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 443}, remote, odcid, odcid)
+	return tracer
+}
+
+func TestServerStatsHandler(t *testing.T) {
+	stats := newServerStats()
+	odcid := quic.ConnectionIDFromBytes([]byte{1, 2, 3, 4})
+	remote := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4433}
+	startConnection(stats, odcid, remote)
+
+	var activeStreams int64
+	handler := stats.handler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.RemoteAddr == remote.String() {
+			activeStreams = stats.snapshot().Connections[0].ActiveStreams
+		}
+		if request.URL.Path == "/missing" {
+			http.NotFound(writer, request)
+		}
+	}))
+	for _, path := range []string{"/", "/missing"} {
+		request := httptest.NewRequest(http.MethodGet, "https://example.com:8443"+path, nil)
+		request.RemoteAddr = remote.String()
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+	request := httptest.NewRequest(http.MethodGet, "https://other.com/", nil)
+	request.RemoteAddr = "127.0.0.1:1"
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	if activeStreams != 1 {
+		t.Errorf("expected 1 active stream while serving, got %d", activeStreams)
+	}
+	snapshot := stats.snapshot()
+	if len(snapshot.Connections) != 1 {
+		t.Fatalf("expected 1 connection, got %d", len(snapshot.Connections))
+	}
+	c := snapshot.Connections[0]
+	if c.Requests != 2 || c.ActiveStreams != 0 {
+		t.Errorf("expected 2 requests and no active streams, got %d and %d", c.Requests, c.ActiveStreams)
+	}
+	if snapshot.RequestsPerHost["example.com"] != 2 || snapshot.RequestsPerHost["other.com"] != 1 {
+		t.Errorf("unexpected requests per host: %v", snapshot.RequestsPerHost)
+	}
+	if snapshot.Errors["http 4xx"] != 1 || len(snapshot.Errors) != 1 {
+		t.Errorf("unexpected errors: %v", snapshot.Errors)
+	}
+}
+
+func TestServerStatsSnapshot(t *testing.T) {
+	stats := newServerStats()
+	if snapshot := stats.snapshot(); snapshot.Connections == nil || len(snapshot.Connections) != 0 {
+		t.Errorf("expected empty connection list, got %v", snapshot.Connections)
+	}
+	first := quic.ConnectionIDFromBytes([]byte{1})
+	second := quic.ConnectionIDFromBytes([]byte{2})
+	firstTracer := startConnection(stats, first, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1})
+	secondTracer := startConnection(stats, second, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 2})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				firstTracer.SentPacket(&logging.ExtendedHeader{}, 1000, nil, nil)
+			}
+		}()
+	}
+	wg.Wait()
+	firstTracer.UpdatedPath(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 3})
+	secondTracer.ClosedConnection(nil)
+
+	snapshot := stats.snapshot()
+	if len(snapshot.Connections) != 1 || snapshot.ClosedConnections != 1 {
+		t.Fatalf("expected 1 open and 1 closed connection, got %d and %d", len(snapshot.Connections), snapshot.ClosedConnections)
+	}
+	c := snapshot.Connections[0]
+	if c.ODCID != first.String() || c.RemoteAddr != "127.0.0.1:3" {
+		t.Errorf("unexpected connection: %+v", c)
+	}
+	if c.PacketsSent != 1000 || c.BytesSent != 1_000_000 {
+		t.Errorf("expected 1000 packets and 1000000 B, got %d and %d B", c.PacketsSent, c.BytesSent)
+	}
+	if len(snapshot.Errors) != 0 {
+		t.Errorf("expected no errors, got %v", snapshot.Errors)
+	}
+	// a closed connection is not closed again
+	secondTracer.ClosedConnection(nil)
+	if snapshot := stats.snapshot(); snapshot.ClosedConnections != 1 {
+		t.Errorf("expected 1 closed connection, got %d", snapshot.ClosedConnections)
+	}
+}